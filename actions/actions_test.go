@@ -2,9 +2,13 @@ package actions
 
 import (
 	"testing"
+	"time"
 
 	"github.com/gobuffalo/packr"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/suite"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type ActionSuite struct {
@@ -22,3 +26,19 @@ func Test_ActionSuite(t *testing.T) {
 	}
 	suite.Run(t, as)
 }
+
+// createUser saves a verified user with the "password" password.
+func (as *ActionSuite) createUser(username string, role string) *models.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	as.NoError(err)
+	user := &models.User{
+		Name:            username,
+		Username:        username,
+		Email:           username + "@example.com",
+		Role:            role,
+		EmailVerifiedAt: nulls.NewTime(time.Now()),
+		PasswordHash:    string(hash),
+	}
+	as.NoError(as.DB.Create(user))
+	return user
+}
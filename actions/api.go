@@ -0,0 +1,251 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/middleware"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// apiSecret signs the tokens handed out by the API.
+var apiSecret = models.Secret("API_SECRET", "blogapp-development-api-secret")
+
+// apiTokenLifetime is how long an API token stays valid.
+var apiTokenLifetime = 24 * time.Hour
+
+// apiRoutes mounts the JSON API on app. The API authenticates requests
+// with bearer tokens, so the session and CSRF middlewares are not used.
+func apiRoutes(app *buffalo.App) {
+	api := app.Group("/api/v1")
+	api.Middleware.Clear()
+	api.Use(forceSSL())
+	api.Use(middleware.PopTransaction(models.DB))
+	api.Use(SetCurrentUserFromToken)
+	api.Use(APIAuthenticate)
+	api.Use(APIScopes)
+
+	api.POST("/auth/token", APITokensCreate)
+
+	api.GET("/posts", APIPostsList)
+	api.POST("/posts", APIPermissionRequired(models.PermPostCreate, APIPostsCreate))
+	api.GET("/posts/{pid}", APIPostsShow)
+	api.PUT("/posts/{pid}", APILoginRequired(APIPostsUpdate))
+	api.DELETE("/posts/{pid}", APILoginRequired(APIPostsDestroy))
+
+	api.GET("/posts/{pid}/comments", APICommentsList)
+	api.POST("/posts/{pid}/comments", APIPermissionRequired(models.PermCommentCreate, APICommentsCreate))
+	api.DELETE("/comments/{cid}", APILoginRequired(APICommentsDestroy))
+
+	api.GET("/tags", APITagsList)
+	api.POST("/tags", APIPermissionRequired(models.PermTagManage, APIAdminScope(APITagsCreate)))
+}
+
+// apiError is the envelope of every API error.
+type apiError struct {
+	Status  int                 `json:"status"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+// renderAPIError renders an error envelope. fields holds the
+// validate.Errors of the request, if any.
+func renderAPIError(c buffalo.Context, status int, message string, fields map[string][]string) error {
+	return c.Render(status, r.JSON(map[string]interface{}{
+		"error": apiError{Status: status, Message: message, Fields: fields},
+	}))
+}
+
+// renderAPIData renders a successful response.
+func renderAPIData(c buffalo.Context, status int, data interface{}) error {
+	return c.Render(status, r.JSON(map[string]interface{}{"data": data}))
+}
+
+// renderAPIPage renders a page of results with its pagination metadata.
+func renderAPIPage(c buffalo.Context, data interface{}, paginator *pop.Paginator) error {
+	return c.Render(200, r.JSON(map[string]interface{}{
+		"data": data,
+		"meta": map[string]interface{}{"pagination": paginator},
+	}))
+}
+
+// APITokensCreate POST implementation. Exchanges an email and password
+// for a bearer token. Users with two-factor authentication also send a
+// code.
+func APITokensCreate(c buffalo.Context) error {
+	creds := struct {
+		Email    string `json:"email" form:"email"`
+		Password string `json:"password" form:"password"`
+		Code     string `json:"code" form:"code"`
+	}{}
+	if err := c.Bind(&creds); err != nil {
+		return renderAPIError(c, 400, "Malformed request body.", nil)
+	}
+	wait, err := loginWait(c, creds.Email)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if wait != "" {
+		return renderAPIError(c, 429, wait, nil)
+	}
+
+	user := &models.User{Email: creds.Email, Password: creds.Password}
+	tx := c.Value("tx").(*pop.Connection)
+	if err := user.Authorize(tx); err != nil {
+		if err := loginFailed(c, creds.Email); err != nil {
+			return errors.WithStack(err)
+		}
+		return renderAPIError(c, 401, "Invalid email or password.", nil)
+	}
+	if user.HasTwoFactor() {
+		ok, err := user.VerifySecondFactor(tx, creds.Code, time.Now())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !ok {
+			if err := loginFailed(c, creds.Email); err != nil {
+				return errors.WithStack(err)
+			}
+			return renderAPIError(c, 401, "A valid two-factor authentication code is required.", nil)
+		}
+	}
+	if err := loginSucceeded(user); err != nil {
+		return errors.WithStack(err)
+	}
+
+	expires := time.Now().Add(apiTokenLifetime)
+	token, err := signAPIToken(user.ID, expires)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIData(c, 201, map[string]interface{}{
+		"token":      token,
+		"expires_at": expires,
+	})
+}
+
+// APIAuthenticate sets current_user from the signed bearer token of the
+// request. Requests without a token go on anonymously.
+func APIAuthenticate(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		// Personal access tokens are handled by SetCurrentUserFromToken
+		if _, ok := c.Value("current_user").(*models.User); ok {
+			return next(c)
+		}
+		token := bearerToken(c)
+		if token == "" {
+			return next(c)
+		}
+		uid, err := parseAPIToken(token)
+		if err != nil {
+			return renderAPIError(c, 401, "Invalid or expired token.", nil)
+		}
+		u := &models.User{}
+		tx := c.Value("tx").(*pop.Connection)
+		if err := tx.Find(u, uid); err != nil {
+			return renderAPIError(c, 401, "Invalid or expired token.", nil)
+		}
+		c.Set("current_user", u)
+		return next(c)
+	}
+}
+
+// APIScopes requires the read scope to read and the write scope to change
+// anything.
+func APIScopes(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		switch c.Request().Method {
+		case "GET", "HEAD", "OPTIONS":
+			return APIScopeRequired(models.ScopeRead, next)(c)
+		}
+		return APIScopeRequired(models.ScopeWrite, next)(c)
+	}
+}
+
+// APILoginRequired requires a valid bearer token.
+func APILoginRequired(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		user, ok := c.Value("current_user").(*models.User)
+		if !ok {
+			return renderAPIError(c, 401, "Authentication required.", nil)
+		}
+		missing, err := twoFactorMissing(c, user)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if missing {
+			return renderAPIError(c, 403, "Admins must enable two-factor authentication first.", nil)
+		}
+		return next(c)
+	}
+}
+
+// APIPermissionRequired requires the bearer token of a user whose role
+// grants perm.
+func APIPermissionRequired(perm models.Permission, next buffalo.Handler) buffalo.Handler {
+	return APILoginRequired(func(c buffalo.Context) error {
+		if !currentUser(c).Can(perm) {
+			return renderAPIError(c, 403, "You are not allowed to do that.", nil)
+		}
+		return next(c)
+	})
+}
+
+// APIAdminScope requires personal access tokens to carry the admin scope,
+// needed to act on content owned by other users.
+func APIAdminScope(next buffalo.Handler) buffalo.Handler {
+	return APIScopeRequired(models.ScopeAdmin, next)
+}
+
+// apiAllowed reports whether the current user can act on content, owned
+// or not. Personal access tokens need the admin scope for the content of
+// other users.
+func apiAllowed(c buffalo.Context, allowed, owned bool) bool {
+	if !allowed {
+		return false
+	}
+	if token, ok := c.Value("current_token").(*models.AccessToken); ok && !owned {
+		return token.HasScope(models.ScopeAdmin)
+	}
+	return true
+}
+
+// bearerToken reads the token of the Authorization header.
+func bearerToken(c buffalo.Context) string {
+	const prefix = "Bearer "
+	header := c.Request().Header.Get("Authorization")
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return ""
+	}
+	return header[len(prefix):]
+}
+
+// signAPIToken creates a signed token for the user.
+func signAPIToken(uid uuid.UUID, expires time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   uid.String(),
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	return token.SignedString(apiSecret)
+}
+
+// parseAPIToken checks the signature and expiry of a token, returning
+// the id of its user.
+func parseAPIToken(s string) (uuid.UUID, error) {
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(s, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return apiSecret, nil
+	})
+	if err != nil {
+		return uuid.Nil, errors.WithStack(err)
+	}
+	return uuid.FromString(claims.Subject)
+}
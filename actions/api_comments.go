@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// APICommentsList GET implementation. Params "page" and "per_page"
+// control pagination.
+func APICommentsList(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	post, _, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil || !canSeePost(c, post) {
+		return renderAPIError(c, 404, "Post not found.", nil)
+	}
+
+	comments := models.Comments{}
+	q := tx.PaginateFromParams(c.Params())
+	q = models.VisibleComments(q.Where("post_id = ?", post.ID), currentUser(c))
+	if err := q.Order("created_at asc").All(&comments); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIPage(c, comments, q.Paginator)
+}
+
+// APICommentsCreate POST implementation.
+func APICommentsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	user := c.Value("current_user").(*models.User)
+	if !user.CanComment() {
+		return renderAPIError(c, 403, "Verify your email address before commenting.", nil)
+	}
+
+	post, _, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil || !canSeePost(c, post) {
+		return renderAPIError(c, 404, "Post not found.", nil)
+	}
+
+	comment := &models.Comment{}
+	if err := c.Bind(comment); err != nil {
+		return renderAPIError(c, 400, "Malformed request body.", nil)
+	}
+	// New comments are never removed
+	comment.DeletedAt = nulls.Time{}
+	comment.PostID = post.ID
+	comment.AuthorID = user.ID
+	if err := comment.SetInitialStatus(tx, user); err != nil {
+		return errors.WithStack(err)
+	}
+	checkSpam(c, tx, comment, user)
+	if comment.ParentID.Valid {
+		if _, err := models.FindReplyParent(tx, post.ID, comment.ParentID.UUID.String()); err != nil {
+			return renderAPIError(c, 422, "Parent comment not found.", nil)
+		}
+	}
+
+	verrs, err := tx.ValidateAndCreate(comment)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderAPIError(c, 422, "Validation failed.", verrs.Errors)
+	}
+	if comment.Status == models.CommentApproved {
+		if err := notifyComment(tx, comment); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return renderAPIData(c, 201, comment)
+}
+
+// APICommentsDestroy DELETE implementation. Comments can be deleted by
+// their author or a moderator.
+func APICommentsDestroy(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	user := c.Value("current_user").(*models.User)
+
+	comment := &models.Comment{}
+	if err := tx.Find(comment, c.Param("cid")); err != nil {
+		return renderAPIError(c, 404, "Comment not found.", nil)
+	}
+	if !apiAllowed(c, user.CanDeleteComment(comment), comment.AuthorID == user.ID) {
+		return renderAPIError(c, 403, "You are not allowed to do that.", nil)
+	}
+	if err := comment.Remove(tx, time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIData(c, 200, comment)
+}
@@ -0,0 +1,163 @@
+package actions
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// apiPost is the representation of a post in the API.
+type apiPost struct {
+	models.Post
+	Tags []int `json:"tags"`
+}
+
+// apiPostParams are the fields of a post accepted by the API.
+type apiPostParams struct {
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Status    string `json:"status"`
+	PublishAt string `json:"publish_at"`
+	Tags      []int  `json:"tags"`
+}
+
+// apply copies the params into post.
+func (p apiPostParams) apply(post *models.Post) {
+	post.Title = p.Title
+	post.Content = p.Content
+	post.Status = p.Status
+	post.PublishAt = p.PublishAt
+}
+
+// APIPostsList GET implementation. Params "page" and "per_page" control
+// pagination.
+func APIPostsList(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	posts := models.Posts{}
+	q := tx.PaginateFromParams(c.Params())
+	if err := listPosts(visiblePosts(c, q)).All(&posts); err != nil {
+		return errors.WithStack(err)
+	}
+
+	data := make([]apiPost, len(posts))
+	for i := range posts {
+		codes, err := posts[i].TagCodes(tx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		data[i] = apiPost{Post: posts[i], Tags: codes}
+	}
+	return renderAPIPage(c, data, q.Paginator)
+}
+
+// APIPostsShow GET implementation. The pid param accepts ids and slugs.
+func APIPostsShow(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	post, _, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil || !canSeePost(c, post) {
+		return renderAPIError(c, 404, "Post not found.", nil)
+	}
+	return renderAPIPost(c, tx, 200, post)
+}
+
+// APIPostsCreate POST implementation. Posts created through the API don't
+// have an image.
+func APIPostsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	user := c.Value("current_user").(*models.User)
+
+	params := apiPostParams{}
+	if err := c.Bind(&params); err != nil {
+		return renderAPIError(c, 400, "Malformed request body.", nil)
+	}
+	post := &models.Post{AuthorID: user.ID}
+	params.apply(post)
+
+	verrs, err := post.Create(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderAPIError(c, 422, "Validation failed.", verrs.Errors)
+	}
+	if err := post.Revise(tx, user.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := post.SyncTags(tx, params.Tags); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIPost(c, tx, 201, post)
+}
+
+// APIPostsUpdate PUT implementation.
+func APIPostsUpdate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	user := c.Value("current_user").(*models.User)
+
+	post, _, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil {
+		return renderAPIError(c, 404, "Post not found.", nil)
+	}
+	if !apiAllowed(c, user.CanEditPost(post), post.AuthorID == user.ID) {
+		return renderAPIError(c, 403, "You are not allowed to do that.", nil)
+	}
+
+	params := apiPostParams{}
+	if err := c.Bind(&params); err != nil {
+		return renderAPIError(c, 400, "Malformed request body.", nil)
+	}
+	params.apply(post)
+
+	verrs, err := post.Update(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderAPIError(c, 422, "Validation failed.", verrs.Errors)
+	}
+	if err := post.Revise(tx, user.ID); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := post.SyncTags(tx, params.Tags); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIPost(c, tx, 200, post)
+}
+
+// APIPostsDestroy DELETE implementation.
+func APIPostsDestroy(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	user := c.Value("current_user").(*models.User)
+
+	post, _, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil {
+		return renderAPIError(c, 404, "Post not found.", nil)
+	}
+	if !apiAllowed(c, user.CanEditPost(post), post.AuthorID == user.ID) {
+		return renderAPIError(c, 403, "You are not allowed to do that.", nil)
+	}
+	if err := tx.Destroy(post); err != nil {
+		return errors.WithStack(err)
+	}
+	if post.FileName != "" {
+		if err := post.DeleteFile(tx); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := collectUploads(tx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return renderAPIData(c, 200, post)
+}
+
+// renderAPIPost renders a single post with its tags.
+func renderAPIPost(c buffalo.Context, tx *pop.Connection, status int, post *models.Post) error {
+	codes, err := post.TagCodes(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIData(c, status, apiPost{Post: *post, Tags: codes})
+}
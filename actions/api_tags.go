@@ -0,0 +1,43 @@
+package actions
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// APITagsList GET implementation. Params "page" and "per_page" control
+// pagination.
+func APITagsList(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	tags := models.Tags{}
+	q := tx.PaginateFromParams(c.Params())
+	if err := q.Order("name asc").All(&tags); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIPage(c, tags, q.Paginator)
+}
+
+// APITagsCreate POST implementation.
+func APITagsCreate(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	tag := &models.Tag{}
+	if err := c.Bind(tag); err != nil {
+		return renderAPIError(c, 400, "Malformed request body.", nil)
+	}
+	verrs, err := tag.Generate(tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return renderAPIError(c, 422, "Validation failed.", verrs.Errors)
+	}
+	// Read back the code given by the database
+	if err := tx.Reload(tag); err != nil {
+		return errors.WithStack(err)
+	}
+	return renderAPIData(c, 201, tag)
+}
@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// apiToken logs the user in through the API and returns its bearer token.
+func (as *ActionSuite) apiToken(user *models.User) string {
+	res := as.JSON("/api/v1/auth/token").Post(map[string]string{
+		"email":    user.Email,
+		"password": "password",
+	})
+	as.Equal(201, res.Code)
+
+	body := struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}{}
+	as.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+	return body.Data.Token
+}
+
+func (as *ActionSuite) Test_API_Posts_List() {
+	post := &models.Post{Title: "API post", Slug: "api-post", Content: "content", Status: models.PostPublished}
+	as.NoError(as.DB.Create(post))
+
+	res := as.JSON("/api/v1/posts").Get()
+	as.Equal(200, res.Code)
+	as.Contains(res.Body.String(), "API post")
+	as.Contains(res.Body.String(), `"pagination"`)
+}
+
+func (as *ActionSuite) Test_API_Posts_Create() {
+	res := as.JSON("/api/v1/posts").Post(map[string]string{"title": "Anonymous"})
+	as.Equal(401, res.Code)
+
+	admin := as.createUser("apiadmin", models.RoleAdmin)
+	req := as.JSON("/api/v1/posts")
+	req.Headers["Authorization"] = "Bearer " + as.apiToken(admin)
+
+	res = req.Post(map[string]string{"title": "Missing content", "status": models.PostDraft})
+	as.Equal(422, res.Code)
+	as.Contains(res.Body.String(), `"fields"`)
+
+	res = req.Post(map[string]string{"title": "From the API", "content": "hello", "status": models.PostPublished})
+	as.Equal(201, res.Code)
+	as.Contains(res.Body.String(), `"slug":"from-the-api"`)
+}
+
+func (as *ActionSuite) Test_API_PersonalAccessToken() {
+	admin := as.createUser("tokenadmin", models.RoleAdmin)
+	token := &models.AccessToken{UserID: admin.ID, Name: "reader"}
+	verrs, err := token.Generate(as.DB, []string{models.ScopeRead}, 0)
+	as.NoError(err)
+	as.False(verrs.HasAny())
+
+	req := as.JSON("/api/v1/posts")
+	req.Headers["Authorization"] = "Bearer " + token.Token
+	res := req.Get()
+	as.Equal(200, res.Code)
+
+	res = req.Post(map[string]string{"title": "Nope", "content": "nope"})
+	as.Equal(403, res.Code)
+
+	req.Headers["Authorization"] = "Bearer blog_unknown"
+	res = req.Get()
+	as.Equal(401, res.Code)
+}
+
+func (as *ActionSuite) Test_API_TwoFactorToken() {
+	user := as.createUser("apitwofa", models.RoleCommenter)
+	as.NoError(user.StartTwoFactor(as.DB))
+	code, err := models.TOTPCode(user.TOTPSecret, time.Now())
+	as.NoError(err)
+	ok, err := user.EnableTwoFactor(as.DB, code, time.Now().Add(-30*time.Second))
+	as.NoError(err)
+	as.True(ok)
+
+	creds := map[string]string{"email": user.Email, "password": "password"}
+	res := as.JSON("/api/v1/auth/token").Post(creds)
+	as.Equal(401, res.Code)
+
+	code, err = models.TOTPCode(user.TOTPSecret, time.Now().Add(30*time.Second))
+	as.NoError(err)
+	creds["code"] = code
+	res = as.JSON("/api/v1/auth/token").Post(creds)
+	as.Equal(201, res.Code)
+}
+
+func (as *ActionSuite) Test_Admin_TwoFactorRequired() {
+	admin := as.createUser("lockedadmin", models.RoleAdmin)
+	as.NoError(models.SaveSetting(as.DB, models.SettingRequireAdmin2FA, "true"))
+
+	req := as.JSON("/api/v1/tags")
+	req.Headers["Authorization"] = "Bearer " + as.apiToken(admin)
+	res := req.Post(map[string]string{"name": "Locked"})
+	as.Equal(403, res.Code)
+	as.Contains(res.Body.String(), "two-factor")
+}
@@ -29,6 +29,8 @@ func App() *buffalo.App {
 		app = buffalo.New(buffalo.Options{
 			Env:         ENV,
 			SessionName: "_blogapp_session",
+			Worker:      jobQueue,
+			WorkerOff:   jobsWorkerOff,
 		})
 		// Automatically redirect to SSL
 		app.Use(forceSSL())
@@ -49,9 +51,21 @@ func App() *buffalo.App {
 		// Save current user into context
 		app.Use(SetCurrentUser)
 
+		// Keep admins on their account page until they enable two-factor
+		// authentication, when the site requires it
+		app.Use(TwoFactorEnforced)
+
 		// Setup and use translations:
 		app.Use(translations())
 
+		// Publish scheduled posts in the background
+		if err := registerJobs(app.Worker); err != nil {
+			app.Stop(err)
+		}
+		if ENV != "test" {
+			startScheduler(app.Context, app)
+		}
+
 		app.GET("/", HomeHandler)
 
 		// Users routing
@@ -59,44 +73,92 @@ func App() *buffalo.App {
 		users.GET("/", AdminRequired(List))
 		users.POST("/", Create)
 		users.GET("/new", New)
+		users.GET("/verify/{token}", UsersVerify)
 		users.GET("/{user_id}", Show)
-		users.PUT("/{user_id}", Update)
+		users.PUT("/{user_id}", LoginRequired(Update))
+		users.PUT("/{user_id}/role", AdminRequired(UsersRoleUpdate))
+		users.POST("/{user_id}/verification", LoginRequired(UsersVerificationResend))
+		users.PUT("/{user_id}/verify", AdminRequired(UsersVerifyUpdate))
+		users.PUT("/{user_id}/unlock", AdminRequired(UsersUnlock))
 		users.DELETE("/{user_id}", AdminRequired(Destroy))
-		users.GET("/{user_id}/edit", Edit)
+		users.GET("/{user_id}/edit", LoginRequired(Edit))
+		users.GET("/{user_id}/feed.atom", UsersFeed)
+		users.POST("/{user_id}/tokens", LoginRequired(TokensCreate))
+		users.DELETE("/{user_id}/tokens/{token_id}", LoginRequired(TokensDestroy))
+		users.POST("/{user_id}/two_factor", LoginRequired(TwoFactorCreate))
+		users.PUT("/{user_id}/two_factor", LoginRequired(TwoFactorUpdate))
+		users.DELETE("/{user_id}/two_factor", LoginRequired(TwoFactorDestroy))
+		users.POST("/{user_id}/recovery_codes", LoginRequired(RecoveryCodesCreate))
+		users.DELETE("/{user_id}/identities/{identity_id}", LoginRequired(IdentitiesDestroy))
+		users.DELETE("/{user_id}/sessions", LoginRequired(SessionsDestroyOthers))
+		users.DELETE("/{user_id}/sessions/{session_id}", LoginRequired(SessionsDestroy))
+		users.PUT("/{user_id}/notifications", LoginRequired(NotificationsUpdate))
+		app.GET("/notifications/unsubscribe/{token}", NotificationsUnsubscribe)
 		app.GET("/login", UsersLogin)
 		app.POST("/login", UsersLoginPost)
+		app.GET("/login/two_factor", TwoFactorLogin)
+		app.POST("/login/two_factor", TwoFactorLoginPost)
+		app.GET("/login/unlock/{token}", LoginUnlock)
 		app.GET("/logout", UsersLogout)
+		app.GET("/password/forgot", PasswordForgot)
+		app.POST("/password/forgot", PasswordForgotPost)
+		app.GET("/password/reset/{token}", PasswordReset)
+		app.POST("/password/reset/{token}", PasswordResetPost)
 
 		// Posts routing
 		posts := app.Group("/posts")
 		posts.GET("/", PostsIndex)
-		posts.GET("/create", AdminRequired(PostsCreateGet))
-		posts.POST("/create", AdminRequired(PostsCreatePost))
-		posts.GET("/edit/{pid}", AdminRequired(PostsEditGet))
-		posts.POST("/edit/{pid}", AdminRequired(PostsEditPost))
-		posts.GET("/delete/{pid}", PostsDelete)
+		posts.GET("/create", PermissionRequired(models.PermPostCreate)(PostsCreateGet))
+		posts.POST("/create", PermissionRequired(models.PermPostCreate)(PostsCreatePost))
+		posts.GET("/edit/{pid}", LoginRequired(PostsEditGet))
+		posts.POST("/edit/{pid}", LoginRequired(PostsEditPost))
+		posts.GET("/delete/{pid}", LoginRequired(PostsDelete))
 		posts.GET("/detail/{pid}", PostsDetail)
+		posts.GET("/revisions/{pid}", LoginRequired(PostsRevisions))
+		posts.POST("/revisions/{pid}/restore/{rid}", LoginRequired(PostsRevisionsRestore))
 		// Posts Tags routing
 		tags := app.Group("/tags")
 		tags.GET("/show/{tag}", TagsShow)
+		tags.GET("/show/{tag}/feed.atom", TagsFeed)
 		tags.GET("/list", TagsList)
-		tags.GET("/new", TagsCreateGet)
-		tags.POST("/new", TagsCreatePost)
-		tags.DELETE("/destroy/{tag}", TagsDestroy)
+		tags.GET("/new", PermissionRequired(models.PermTagManage)(TagsCreateGet))
+		tags.POST("/new", PermissionRequired(models.PermTagManage)(TagsCreatePost))
+		tags.DELETE("/destroy/{tag}", PermissionRequired(models.PermTagManage)(TagsDestroy))
+
+		// Feeds routing
+		app.GET("/feed.rss", FeedsRSS)
+		app.GET("/feed.atom", FeedsAtom)
+
+		// Search routing
+		app.GET("/search", SearchIndex)
+
+		// Admin routing
+		admin := app.Group("/admin")
+		admin.Use(AdminRequired)
+		admin.GET("/settings", SettingsIndex)
+		admin.PUT("/settings", SettingsUpdate)
+		admin.GET("/jobs", JobsIndex)
+		admin.PUT("/jobs/{job_id}/retry", JobsRetry)
+		admin.DELETE("/jobs/{job_id}", JobsDestroy)
 
 		// Comments routing
 		comments := app.Group("/comments")
 		comments.Use(LoginRequired)
-		comments.POST("/create/{pid}", CommentsCreatePost)
+		comments.POST("/create/{pid}", PermissionRequired(models.PermCommentCreate)(CommentsCreatePost))
 		comments.GET("/edit/{cid}", CommentsEditGet)
 		comments.POST("/edit/{cid}", CommentsEditPost)
 		comments.GET("/delete/{cid}", CommentsDelete)
+		comments.GET("/moderation", PermissionRequired(models.PermCommentModerate)(CommentsModeration))
+		comments.PUT("/moderation", PermissionRequired(models.PermCommentModerate)(CommentsModerate))
 
-		// GitHub OAuth routing
+		// OAuth routing
 		auth := app.Group("/auth")
 		auth.GET("/{provider}", buffalo.WrapHandlerFunc(gothic.BeginAuthHandler))
 		auth.GET("/{provider}/callback", AuthCallback)
 
+		// JSON API routing
+		apiRoutes(app)
+
 		app.ServeFiles("/", assetsBox) // serve files from the public directory
 	}
 
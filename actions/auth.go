@@ -3,61 +3,185 @@ package actions
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/gitlab"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/openidConnect"
 	"github.com/pkg/errors"
 	"github.com/sampalm/buffalo/blogapp/models"
 )
 
+// authProviders lists the names of the configured OAuth providers, in the
+// order they are shown.
+var authProviders []string
+
 func init() {
 	gothic.Store = App().SessionStore
 
-	goth.UseProviders(
-		github.New("67143c95c00aea5bdca3", "ef128240ed83559a2d2f1a1963d1b45d265aa7cb", fmt.Sprintf("%s%s", App().Host, "/auth/github/callback")),
-	)
+	for _, p := range oauthProviders() {
+		goth.UseProviders(p)
+		authProviders = append(authProviders, p.Name())
+	}
+}
+
+// oauthProviders builds the providers whose credentials are set in the
+// environment, e.g. GITHUB_KEY and GITHUB_SECRET.
+func oauthProviders() []goth.Provider {
+	callback := func(name string) string {
+		return fmt.Sprintf("%s/auth/%s/callback", App().Host, name)
+	}
+	providers := []goth.Provider{}
+	if key := envy.Get("GITHUB_KEY", ""); key != "" {
+		providers = append(providers, github.New(key, envy.Get("GITHUB_SECRET", ""), callback("github"), "user:email"))
+	}
+	if key := envy.Get("GITLAB_KEY", ""); key != "" {
+		providers = append(providers, gitlab.New(key, envy.Get("GITLAB_SECRET", ""), callback("gitlab"), "read_user"))
+	}
+	if key := envy.Get("GOOGLE_KEY", ""); key != "" {
+		providers = append(providers, google.New(key, envy.Get("GOOGLE_SECRET", ""), callback("google"), "email", "profile"))
+	}
+	if key := envy.Get("OPENID_CONNECT_KEY", ""); key != "" {
+		p, err := openidConnect.New(key, envy.Get("OPENID_CONNECT_SECRET", ""), callback("openid-connect"), envy.Get("OPENID_CONNECT_DISCOVERY_URL", ""), "email", "profile")
+		if err != nil {
+			app.Stop(err)
+		} else {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// providerVerifiedEmail reports whether the provider vouches for the
+// email of the user. GitHub and GitLab only hand out verified addresses,
+// Google and OpenID Connect say so in a claim.
+func providerVerifiedEmail(guser goth.User) bool {
+	if guser.Email == "" {
+		return false
+	}
+	switch guser.Provider {
+	case "github", "gitlab":
+		return true
+	}
+	for _, claim := range []string{"email_verified", "verified_email"} {
+		if v, ok := guser.RawData[claim].(bool); ok {
+			return v
+		}
+	}
+	return false
 }
 
+// AuthCallback logs in the user of a provider account. Signed in users
+// link the account to theirs instead. Unknown accounts are matched to a
+// local user by verified email, or registered.
 func AuthCallback(c buffalo.Context) error {
 	guser, err := gothic.CompleteUserAuth(c.Response(), c.Request())
 	if err != nil {
 		return c.Error(401, err)
 	}
 
-	//return c.Render(200, r.JSON(guser))
-	// Do somethingwith the user, maybe register them/sign them in
 	tx, ok := c.Value("tx").(*pop.Connection)
 	if !ok {
 		return errors.WithStack(errors.New("transaction not found"))
 	}
 
 	// Check for the user into the DB
-	user := &models.User{}
-	if err := tx.Where("provider = ? AND provider_id = ?", guser.Provider, guser.UserID).First(user); err != nil {
-		if errors.Cause(err) == sql.ErrNoRows {
-			// Register isnt registered yet
-			user = &models.User{
-				Name:       guser.Name,
-				Username:   guser.NickName,
-				Email:      guser.Email,
-				Admin:      false,
-				Provider:   guser.Provider,
-				ProviderID: guser.UserID,
-			}
-			if err = user.OAuthAndSave(tx); err != nil {
-				return errors.WithStack(err)
+	current := currentUser(c)
+	user, err := models.FindUserByIdentity(tx, guser.Provider, guser.UserID)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return errors.WithStack(err)
+	}
+	if user != nil {
+		if current != nil {
+			if current.ID != user.ID {
+				c.Flash().Add("danger", fmt.Sprintf("This %s account is linked to another user.", guser.Provider))
 			}
-			c.Flash().Add("success", "User was created successfully")
-			c.Redirect(302, "/login")
+			return c.Redirect(302, "/users/%s/edit", current.ID)
+		}
+		return logIn(c, user)
+	}
+
+	// Link the account to the signed in user
+	if current != nil {
+		if err := current.LinkIdentity(tx, guser.Provider, guser.UserID, guser.Email); err != nil {
+			return errors.WithStack(err)
 		}
+		c.Flash().Add("success", fmt.Sprintf("Your %s account is now linked.", guser.Provider))
+		return c.Redirect(302, "/users/%s/edit", current.ID)
+	}
+
+	verified := providerVerifiedEmail(guser)
+	if guser.Email != "" {
+		user, err = models.FindUserByEmail(tx, guser.Email)
+		if err != nil && errors.Cause(err) != sql.ErrNoRows {
+			return errors.WithStack(err)
+		}
+	}
+	if user != nil {
+		// Both sides must have verified the address, or anyone could
+		// take over an account by registering its email first
+		if !verified || !user.IsVerified() {
+			c.Flash().Add("danger", "An account already uses this email. Log in with it, then link your provider account from your profile.")
+			return c.Redirect(302, "/login")
+		}
+		if err := user.LinkIdentity(tx, guser.Provider, guser.UserID, guser.Email); err != nil {
+			return errors.WithStack(err)
+		}
+		return logIn(c, user)
+	}
+
+	// Register the user
+	user = &models.User{
+		Name:     guser.Name,
+		Username: guser.NickName,
+		Email:    guser.Email,
+	}
+	if verified {
+		user.EmailVerifiedAt = nulls.NewTime(time.Now())
+	}
+	if err = user.OAuthAndSave(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := user.LinkIdentity(tx, guser.Provider, guser.UserID, guser.Email); err != nil {
 		return errors.WithStack(err)
 	}
+	if !verified {
+		sendVerification(c, user)
+		c.Flash().Add("info", "Check your inbox to verify your email.")
+	}
+	return logIn(c, user)
+}
 
-	// Log in user
-	c.Flash().Add("success", fmt.Sprintf("Hello %s, Welcome back!", user.Name))
-	c.Session().Set("current_user_id", user.ID)
-	return c.Redirect(302, "/")
+// IdentitiesDestroy unlinks a provider account from the current user.
+// This function is mapped to the path
+// DELETE /users/{user_id}/identities/{identity_id}
+func IdentitiesDestroy(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	// Users can only manage their own identities
+	user := currentUser(c)
+	if user.ID.String() != c.Param("user_id") {
+		return notAuthorized(c, "/")
+	}
+
+	ok, err := user.UnlinkIdentity(tx, c.Param("identity_id"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if ok {
+		c.Flash().Add("success", "The account was unlinked.")
+	} else {
+		c.Flash().Add("danger", "Set a password before unlinking your last provider account.")
+	}
+	return c.Redirect(302, "/users/%s/edit", user.ID)
 }
@@ -0,0 +1,14 @@
+package actions
+
+import "github.com/markbates/goth"
+
+func (as *ActionSuite) Test_ProviderVerifiedEmail() {
+	as.True(providerVerifiedEmail(goth.User{Provider: "github", Email: "a@example.com"}))
+	as.False(providerVerifiedEmail(goth.User{Provider: "github"}))
+	as.False(providerVerifiedEmail(goth.User{Provider: "google", Email: "a@example.com"}))
+	as.True(providerVerifiedEmail(goth.User{
+		Provider: "openid-connect",
+		Email:    "a@example.com",
+		RawData:  map[string]interface{}{"email_verified": true},
+	}))
+}
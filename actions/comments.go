@@ -1,22 +1,37 @@
 package actions
 
 import (
+	"time"
+
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/pkg/errors"
 	"github.com/sampalm/buffalo/blogapp/models"
 )
 
+// commentsMaxDepth is how deep replies are nested on the page, from
+// COMMENTS_MAX_DEPTH. Deeper replies are shown at that depth.
+var commentsMaxDepth = envInt("COMMENTS_MAX_DEPTH", 5, 1)
+
 // CommentsCreate POST default implementation.
 func CommentsCreatePost(c buffalo.Context) error {
 	// Get current user
 	user := c.Value("current_user").(*models.User)
+	if !user.CanComment() {
+		c.Flash().Add("danger", "Please verify your email address before commenting.")
+		return c.Redirect(302, "/posts/detail/%s", c.Param("pid"))
+	}
 	// Bind Comments to the html form template
 	comment := &models.Comment{}
 	if err := c.Bind(comment); err != nil {
 		return errors.WithStack(err)
 	}
+	// The parent only comes from ReplyTo, once checked, and new comments
+	// are never removed
+	comment.ParentID = nulls.UUID{}
+	comment.DeletedAt = nulls.Time{}
 	// Get the DB connection from context
 	tx, ok := c.Value("tx").(*pop.Connection)
 	if !ok {
@@ -29,6 +44,19 @@ func CommentsCreatePost(c buffalo.Context) error {
 	}
 	comment.PostID = postID
 	comment.AuthorID = user.ID
+	// Replies must answer a comment of the same post
+	if pid := c.Request().FormValue("ReplyTo"); pid != "" {
+		parent, err := models.FindReplyParent(tx, postID, pid)
+		if err != nil {
+			c.Flash().Add("danger", "The comment you replied to was not found.")
+			return c.Redirect(302, "/posts/detail/%s", postID)
+		}
+		comment.ParentID = nulls.NewUUID(parent.ID)
+	}
+	if err := comment.SetInitialStatus(tx, user); err != nil {
+		return errors.WithStack(err)
+	}
+	checkSpam(c, tx, comment, user)
 	// Try to create the comment
 	verrs, err := tx.ValidateAndCreate(comment)
 	if err != nil {
@@ -38,6 +66,13 @@ func CommentsCreatePost(c buffalo.Context) error {
 		c.Flash().Add("danger", "There was an error adding your comment.")
 		return c.Redirect(302, "/posts/detail/%s", postID)
 	}
+	if comment.Status != models.CommentApproved {
+		c.Flash().Add("info", "Your comment will be visible once a moderator approves it.")
+		return c.Redirect(302, "/posts/detail/%s", postID)
+	}
+	if err := notifyComment(tx, comment); err != nil {
+		return errors.WithStack(err)
+	}
 	c.Flash().Add("success", "Comment added successfully.")
 	return c.Redirect(302, "/posts/detail/%s", postID)
 }
@@ -58,7 +93,7 @@ func CommentsEditGet(c buffalo.Context) error {
 	}
 
 	// Make sure the Author is the logged in user
-	if user.ID != comment.AuthorID {
+	if !user.CanEditComment(comment) {
 		c.Flash().Add("danger", "You are not authorized to view that page")
 		return c.Redirect(302, "/posts/detail/%s", comment.PostID)
 	}
@@ -81,14 +116,18 @@ func CommentsEditPost(c buffalo.Context) error {
 		return c.Error(404, err)
 	}
 
-	// Bind the comments to the html page
+	// Bind the comments to the html page, it stays in its thread, with
+	// its author and its status
+	stored := *comment
 	if err := c.Bind(comment); err != nil {
 		return errors.WithStack(err)
 	}
+	comment.PostID, comment.AuthorID, comment.ParentID = stored.PostID, stored.AuthorID, stored.ParentID
+	comment.Status, comment.DeletedAt = stored.Status, stored.DeletedAt
 
 	// Make sure the Author is the logged in user
 	user := c.Value("current_user").(*models.User)
-	if user.ID != comment.AuthorID {
+	if !user.CanEditComment(comment) {
 		c.Flash().Add("danger", "You are not authorized to view that page.")
 		return c.Redirect(302, "/posts/detail/%s", comment.PostID)
 	}
@@ -123,15 +162,15 @@ func CommentsDelete(c buffalo.Context) error {
 		return c.Error(404, err)
 	}
 
-	// Check if the user is the Author or Admin
+	// Check if the user is the Author or a moderator
 	user := c.Value("current_user").(*models.User)
-	if user.ID != comment.PostID && user.Admin == false {
+	if !user.CanDeleteComment(comment) {
 		c.Flash().Add("danger", "You are not authorized to view that page")
 		return c.Redirect(302, "/posts/detail/%s", comment.PostID)
 	}
 
-	// Delete comment from DB
-	err := tx.Destroy(comment)
+	// Delete comment from DB, replies keep a placeholder
+	err := comment.Remove(tx, time.Now())
 	if err != nil {
 		return errors.WithStack(err)
 	}
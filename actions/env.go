@@ -0,0 +1,17 @@
+package actions
+
+import (
+	"strconv"
+
+	"github.com/gobuffalo/envy"
+)
+
+// envInt reads a number of at least min from the environment, def when
+// it is missing, invalid or too small.
+func envInt(key string, def, min int) int {
+	n, err := strconv.Atoi(envy.Get(key, ""))
+	if err != nil || n < min {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,215 @@
+package actions
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/pop"
+	"github.com/gorilla/feeds"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"github.com/sampalm/buffalo/blogapp/storage"
+	"github.com/shurcooL/github_flavored_markdown"
+)
+
+// feedSize is the number of posts listed in a feed.
+const feedSize = 20
+
+// FeedsRSS GET implementation. RSS 2.0 feed of the latest posts.
+func FeedsRSS(c buffalo.Context) error {
+	return renderPostsFeed(c, "rss", "Blog App", "/posts", func(q *pop.Query) *pop.Query {
+		return q
+	})
+}
+
+// FeedsAtom GET implementation. Atom feed of the latest posts.
+func FeedsAtom(c buffalo.Context) error {
+	return renderPostsFeed(c, "atom", "Blog App", "/posts", func(q *pop.Query) *pop.Query {
+		return q
+	})
+}
+
+// TagsFeed GET implementation. Atom feed of the latest posts of a tag.
+func TagsFeed(c buffalo.Context) error {
+	// Get the DB connection from context.
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	tag := &models.Tag{}
+	if err := tx.Where("code = ?", c.Param("tag")).First(tag); err != nil {
+		return c.Error(404, err)
+	}
+
+	title := fmt.Sprintf("Blog App - %s", tag.Name)
+	return renderPostsFeed(c, "atom", title, fmt.Sprintf("/tags/show/%d", tag.Code), func(q *pop.Query) *pop.Query {
+		return tagPosts(q, tag)
+	})
+}
+
+// UsersFeed GET implementation. Atom feed of the latest posts of an author.
+func UsersFeed(c buffalo.Context) error {
+	// Get the DB connection from context.
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	author := &models.User{}
+	if err := tx.Find(author, c.Param("user_id")); err != nil {
+		return c.Error(404, err)
+	}
+
+	title := fmt.Sprintf("Blog App - %s", author.Name)
+	return renderPostsFeed(c, "atom", title, "/posts", func(q *pop.Query) *pop.Query {
+		return q.Where("posts.author_id = ?", author.ID)
+	})
+}
+
+// renderPostsFeed renders the latest published posts selected by scope as
+// an "rss" or "atom" feed. Clients sending a matching ETag or
+// If-Modified-Since header get a 304 response.
+func renderPostsFeed(c buffalo.Context, format, title, path string, scope func(*pop.Query) *pop.Query) error {
+	// Get the DB connection from context.
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	// Feeds never show drafts, even to admins
+	posts := models.Posts{}
+	q := listPosts(scope(tx.Q().Scope(models.PublishedPosts))).Limit(feedSize)
+	if err := q.All(&posts); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Answer conditional requests
+	modified, etag := feedVersion(posts)
+	res := c.Response()
+	res.Header().Set("ETag", etag)
+	// An empty feed has no date to give
+	if !modified.IsZero() {
+		res.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if feedNotModified(c.Request(), modified, etag) {
+		res.WriteHeader(304)
+		return nil
+	}
+
+	// Find the authors of the posts
+	authors := map[string]*models.User{}
+	for _, p := range posts {
+		if _, ok := authors[p.AuthorID.String()]; ok {
+			continue
+		}
+		author := &models.User{}
+		if err := tx.Find(author, p.AuthorID); err != nil {
+			return errors.WithStack(err)
+		}
+		authors[p.AuthorID.String()] = author
+	}
+
+	host := App().Host
+	feed := &feeds.Feed{
+		Title:   title,
+		Link:    &feeds.Link{Href: host + path},
+		Id:      host + path,
+		Updated: modified,
+	}
+	for _, p := range posts {
+		author := authors[p.AuthorID.String()]
+		// Embedded attachments become plain Markdown images
+		attachments, err := p.Attachments(tx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		content := models.ExpandShortcodes(p.Content, attachments, func(a models.Attachment) string {
+			return fmt.Sprintf("![%s](%s %q)", a.Alt, feedLink(host, a.UploadKey), a.Caption)
+		})
+		item := &feeds.Item{
+			Title:   p.Title,
+			Link:    &feeds.Link{Href: fmt.Sprintf("%s/posts/detail/%s", host, p.Slug)},
+			Id:      fmt.Sprintf("%s/posts/detail/%s", host, p.ID),
+			Author:  &feeds.Author{Name: author.Name},
+			Created: p.PublishedAt.Time,
+			Updated: p.UpdatedAt,
+			Content: string(github_flavored_markdown.Markdown([]byte(content))),
+		}
+		item.Description = item.Content
+		if p.FileName != "" {
+			item.Enclosure = feedEnclosure(host, p.FileName)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	contentType := "application/atom+xml"
+	toXML := feed.ToAtom
+	if format == "rss" {
+		contentType = "application/rss+xml"
+		toXML = feed.ToRss
+	}
+	body, err := toXML()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(200, r.Func(contentType, func(w io.Writer, d render.Data) error {
+		_, err := io.WriteString(w, body)
+		return err
+	}))
+}
+
+// feedVersion returns the last modification time and the ETag of a feed.
+func feedVersion(posts models.Posts) (time.Time, string) {
+	modified := time.Time{}
+	h := sha1.New()
+	for _, p := range posts {
+		if p.UpdatedAt.After(modified) {
+			modified = p.UpdatedAt
+		}
+		fmt.Fprintf(h, "%s:%d;", p.ID, p.UpdatedAt.UnixNano())
+	}
+	return modified.UTC().Truncate(time.Second), fmt.Sprintf(`"%s"`, hex.EncodeToString(h.Sum(nil)))
+}
+
+// feedNotModified checks the conditional headers of the request.
+func feedNotModified(req *http.Request, modified time.Time, etag string) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		return match == etag
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.IsZero() && !modified.After(since)
+}
+
+// feedEnclosure describes the image of a post. Feed readers fetch it
+// long after, so it gets the longest lasting link of the storage.
+func feedEnclosure(host, filename string) *feeds.Enclosure {
+	enclosure := &feeds.Enclosure{
+		Url:  feedLink(host, filename),
+		Type: mime.TypeByExtension(filepath.Ext(filename)),
+	}
+	if size, err := storage.Default.Size(filename); err == nil {
+		enclosure.Length = strconv.FormatInt(size, 10)
+	}
+	return enclosure
+}
+
+// feedLink returns the absolute and longest lasting link to an uploaded
+// file.
+func feedLink(host, filename string) string {
+	link, _ := storage.Default.URL(filename, 7*24*time.Hour)
+	if strings.HasPrefix(link, "/") {
+		link = host + link
+	}
+	return link
+}
@@ -0,0 +1,38 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (as *ActionSuite) Test_Feeds_Atom() {
+	author := &models.User{Name: "Feed Author", Username: "feeder", Email: "feeder@example.com"}
+	as.NoError(as.DB.Create(author))
+	post := &models.Post{Title: "Feed post", Slug: "feed-post", Content: "**bold**", AuthorID: author.ID, Status: models.PostPublished}
+	as.NoError(as.DB.Create(post))
+
+	res := as.HTML("/feed.atom").Get()
+	as.Equal(200, res.Code)
+	as.Contains(res.Header().Get("Content-Type"), "application/atom+xml")
+	as.Contains(res.Body.String(), "Feed post")
+	as.Contains(res.Body.String(), "&lt;strong&gt;bold&lt;/strong&gt;")
+
+	req := as.HTML("/feed.atom")
+	req.Headers["If-None-Match"] = res.Header().Get("ETag")
+	res = req.Get()
+	as.Equal(http.StatusNotModified, res.Code)
+}
+
+func (as *ActionSuite) Test_Feeds_RSS() {
+	res := as.HTML("/feed.rss").Get()
+	as.Equal(200, res.Code)
+	as.Contains(res.Body.String(), "<rss")
+	// Without posts the feed has no modification date
+	as.Empty(res.Header().Get("Last-Modified"))
+
+	req := as.HTML("/feed.rss")
+	req.Headers["If-Modified-Since"] = "Mon, 01 Oct 2018 00:00:00 GMT"
+	res = req.Get()
+	as.Equal(200, res.Code)
+}
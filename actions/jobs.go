@@ -0,0 +1,183 @@
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/jobs"
+	"github.com/sampalm/buffalo/blogapp/mailers"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// jobQueue runs the slow work in the background, from the jobs table.
+// JOBS_CONCURRENCY sets how many jobs run at once. Tests run the jobs
+// right away.
+var jobQueue = newJobQueue()
+
+func newJobQueue() jobs.Queue {
+	if ENV == "test" {
+		return jobs.NewInline()
+	}
+	return jobs.New(models.DB, jobs.Options{Concurrency: envInt("JOBS_CONCURRENCY", 2, 1)})
+}
+
+// jobsWorkerOff keeps the web process from running jobs, with
+// JOBS_WORKER_OFF=true, when they run in "buffalo task jobs:work".
+var jobsWorkerOff = envy.Get("JOBS_WORKER_OFF", "false") == "true"
+
+// mailLink makes the link of an email for the user. ref names what the
+// link is for, when the user is not enough.
+type mailLink func(user *models.User, ref string, now time.Time) (string, error)
+
+// mailJobs lists the emails sent by background jobs. Their links hold
+// secrets, so the jobs only get the user and ref as arguments and make
+// the link themselves.
+var mailJobs = map[string]struct {
+	send func(*models.User, string) error
+	link mailLink
+}{
+	"mail_password_reset":     {mailers.SendPasswordReset, passwordResetLink},
+	"mail_email_verification": {mailers.SendEmailVerification, verificationLink},
+	"mail_account_locked":     {mailers.SendAccountLocked, unlockLink},
+}
+
+// registerJobs registers the handlers of every background job.
+func registerJobs(w worker.Worker) error {
+	for name, job := range mailJobs {
+		if err := w.Register(name, mailJob(job.send, job.link)); err != nil {
+			return err
+		}
+	}
+	if err := registerUploadJobs(w); err != nil {
+		return err
+	}
+	return registerNotificationJobs(w)
+}
+
+// mailJob sends an email of mailJobs. The user comes from the arguments,
+// it may not be committed yet when jobs run inline.
+func mailJob(send func(*models.User, string) error, link mailLink) worker.Handler {
+	return func(args worker.Args) error {
+		id, err := uuid.FromString(fmt.Sprint(args["user_id"]))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		user := &models.User{
+			ID:    id,
+			Name:  fmt.Sprint(args["name"]),
+			Email: fmt.Sprint(args["email"]),
+		}
+		l, err := link(user, fmt.Sprint(args["ref"]), time.Now())
+		if err != nil {
+			return err
+		}
+		return send(user, l)
+	}
+}
+
+// queueMail queues the email handler of mailJobs to the user, once tx is
+// committed. ref is passed to the link of the email.
+func queueMail(tx *pop.Connection, handler string, user *models.User, ref string) error {
+	return jobQueue.PerformTx(tx, worker.Job{
+		Handler: handler,
+		Args: worker.Args{
+			"user_id": user.ID.String(),
+			"name":    user.Name,
+			"email":   user.Email,
+			"ref":     ref,
+		},
+	})
+}
+
+// passwordResetLink issues a new token for the reset with id ref.
+func passwordResetLink(user *models.User, ref string, now time.Time) (string, error) {
+	reset, err := models.FindPendingPasswordReset(models.DB, ref, now)
+	if err != nil {
+		return "", err
+	}
+	if err := reset.IssueToken(models.DB); err != nil {
+		return "", err
+	}
+	return App().Host + "/password/reset/" + reset.Token, nil
+}
+
+// verificationLink verifies the current email of the user.
+func verificationLink(user *models.User, ref string, now time.Time) (string, error) {
+	return App().Host + "/users/verify/" + user.VerificationToken(now), nil
+}
+
+// unlockLink unlocks the account of the user, locked out by failed logins.
+func unlockLink(user *models.User, ref string, now time.Time) (string, error) {
+	token := models.SignToken(unlockPurpose, user.Email, now.Add(24*time.Hour))
+	return App().Host + "/login/unlock/" + token, nil
+}
+
+// JobsIndex lists the background jobs with a status, dead ones by
+// default. Params "page" and "per_page" control pagination. This
+// function is mapped to the path GET /admin/jobs
+func JobsIndex(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	status := c.Param("status")
+	if status == "" {
+		status = models.JobDead
+	}
+	list := models.Jobs{}
+	q := tx.PaginateFromParams(c.Params())
+	if err := q.Where("status = ?", status).Order("run_at asc").All(&list); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Set("jobs", list)
+	c.Set("status", status)
+	c.Set("statuses", models.JobStatuses)
+	c.Set("pagination", q.Paginator)
+	return c.Render(200, r.HTML("jobs/index.html"))
+}
+
+// JobsRetry queues a dead job again. This function is mapped to the path
+// PUT /admin/jobs/{job_id}/retry
+func JobsRetry(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	job := &models.Job{}
+	if err := tx.Find(job, c.Param("job_id")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := job.Retry(tx, time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", fmt.Sprintf("The %s job was queued again.", job.Handler))
+	return c.Redirect(302, "/admin/jobs?status=%s", models.JobDead)
+}
+
+// JobsDestroy drops a job from the queue. This function is mapped to the
+// path DELETE /admin/jobs/{job_id}
+func JobsDestroy(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	job := &models.Job{}
+	if err := tx.Find(job, c.Param("job_id")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := tx.Destroy(job); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", fmt.Sprintf("The %s job was dropped.", job.Handler))
+	return c.Redirect(302, "/admin/jobs?status=%s", job.Status)
+}
@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// unlockPurpose is the purpose of the signed account unlock tokens.
+const unlockPurpose = "unlock-login"
+
+// loginThrottle slows down password guessing. Accounts are locked out
+// after a few failures, addresses after many more.
+var loginThrottle = &models.LoginThrottle{
+	Store:   newAttemptStore(),
+	Account: models.LoginLimit{Threshold: 5, Backoff: time.Second, Lockout: 15 * time.Minute},
+	IP:      models.LoginLimit{Threshold: 50, Lockout: 15 * time.Minute},
+}
+
+// newAttemptStore keeps the failed attempts in the database, outside of
+// the request transactions, except in tests.
+func newAttemptStore() models.AttemptStore {
+	if ENV == "test" {
+		return models.NewMemoryAttemptStore()
+	}
+	return models.DBAttemptStore{DB: models.DB}
+}
+
+// clientIP returns the address of the client. The X-Forwarded-For header
+// is only trusted behind a proxy, with TRUST_PROXY=true.
+func clientIP(c buffalo.Context) string {
+	req := c.Request()
+	if envy.Get("TRUST_PROXY", "false") == "true" {
+		if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// loginWait returns a message telling to wait when the login attempts for
+// email must slow down, or an empty string.
+func loginWait(c buffalo.Context, email string) (string, error) {
+	wait, err := loginThrottle.Wait(email, clientIP(c), time.Now())
+	if err != nil || wait == 0 {
+		return "", err
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("Too many failed attempts, try again in %s.", wait.Round(time.Second)), nil
+}
+
+// loginFailed counts a failed login attempt for email. When it locks the
+// account out, the lockout is audited and the owner gets an unlock link.
+func loginFailed(c buffalo.Context, email string) error {
+	ip := clientIP(c)
+	locked, err := loginThrottle.Fail(email, ip, time.Now())
+	if err != nil || !locked {
+		return err
+	}
+
+	// The request is rolled back, so the database is used directly
+	user := &models.User{}
+	if err := models.DB.Where("email = ?", email).First(user); err != nil {
+		return models.RecordAudit(models.DB, &models.AuditEvent{Action: models.AuditLoginLocked, IP: ip, Details: email})
+	}
+	err = models.RecordAudit(models.DB, &models.AuditEvent{
+		Action:  models.AuditLoginLocked,
+		UserID:  nulls.NewUUID(user.ID),
+		IP:      ip,
+		Details: email,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := queueMail(models.DB, "mail_account_locked", user, ""); err != nil {
+		c.Logger().Errorf("unlock email to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+// loginSucceeded forgets the failed attempts of the user.
+func loginSucceeded(user *models.User) error {
+	return loginThrottle.Unlock(user.Email)
+}
+
+// LoginUnlock lifts the lockout of an account from the link emailed to
+// its owner. This function is mapped to the path
+// GET /login/unlock/{token}
+func LoginUnlock(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	email, err := models.VerifySignedToken(unlockPurpose, c.Param("token"), time.Now())
+	if err != nil {
+		c.Flash().Add("danger", "This unlock link is invalid or has expired.")
+		return c.Redirect(302, "/login")
+	}
+	user := &models.User{}
+	if err := tx.Where("email = ?", email).First(user); err != nil {
+		return c.Error(404, err)
+	}
+	if err := unlockUser(c, tx, user); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", "Your account is unlocked, you can log in again.")
+	return c.Redirect(302, "/login")
+}
+
+// UsersUnlock lets admins lift the lockout of an account. This function
+// is mapped to the path PUT /users/{user_id}/unlock
+func UsersUnlock(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	user := &models.User{}
+	if err := tx.Find(user, c.Param("user_id")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := unlockUser(c, tx, user); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", fmt.Sprintf("%s is unlocked.", user.Username))
+	return c.Redirect(302, "/users/%s", user.ID)
+}
+
+// unlockUser forgets the failed attempts of the user and audits it.
+func unlockUser(c buffalo.Context, tx *pop.Connection, user *models.User) error {
+	if err := loginThrottle.Unlock(user.Email); err != nil {
+		return err
+	}
+	e := &models.AuditEvent{
+		Action: models.AuditLoginUnlocked,
+		UserID: nulls.NewUUID(user.ID),
+		IP:     clientIP(c),
+	}
+	if actor := currentUser(c); actor != nil {
+		e.ActorID = nulls.NewUUID(actor.ID)
+	}
+	return models.RecordAudit(tx, e)
+}
@@ -0,0 +1,19 @@
+package actions
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (as *ActionSuite) Test_Login_Throttled() {
+	user := as.createUser("guessed", models.RoleCommenter)
+
+	res := as.HTML("/login").Post(map[string]string{"Email": user.Email, "Password": "wrong"})
+	as.Equal(422, res.Code)
+
+	// The right password has to wait for the backoff too
+	res = as.HTML("/login").Post(map[string]string{"Email": user.Email, "Password": "password"})
+	as.Equal(429, res.Code)
+	as.Contains(res.Body.String(), "Too many failed attempts")
+
+	as.NoError(loginThrottle.Unlock(user.Email))
+	res = as.HTML("/login").Post(map[string]string{"Email": user.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+}
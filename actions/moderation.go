@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"fmt"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// moderatedComment is a comment of the moderation queue with its post.
+type moderatedComment struct {
+	models.Comment
+	Post models.Post
+}
+
+// CommentsModeration lists the comments with a status, pending by
+// default, for moderators. Params "page" and "per_page" control
+// pagination. This function is mapped to the path
+// GET /comments/moderation
+func CommentsModeration(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	status := c.Param("status")
+	if status == "" {
+		status = models.CommentPending
+	}
+	comments := models.Comments{}
+	q := tx.PaginateFromParams(c.Params())
+	if err := q.Where("status = ?", status).Order("created_at asc").All(&comments); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Find the author and post of every comment
+	queue := make([]moderatedComment, len(comments))
+	for i, comment := range comments {
+		queue[i].Comment = comment
+		if err := tx.Find(&queue[i].Author, comment.AuthorID); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := tx.Find(&queue[i].Post, comment.PostID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	c.Set("comments", queue)
+	c.Set("status", status)
+	c.Set("statuses", models.CommentStatuses)
+	c.Set("pagination", q.Paginator)
+	return c.Render(200, r.HTML("comments/moderation.html"))
+}
+
+// CommentsModerate sets the status of the selected comments. This
+// function is mapped to the path PUT /comments/moderation
+func CommentsModerate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	req := c.Request()
+	if err := req.ParseForm(); err != nil {
+		return errors.WithStack(err)
+	}
+	status := req.FormValue("Status")
+	changed, err := models.ModerateComments(tx, req.Form["CommentIDs"], status)
+	if err != nil {
+		c.Flash().Add("danger", "Choose what to do with the selected comments.")
+		return c.Redirect(302, "/comments/moderation")
+	}
+
+	// Approved comments are news to the post and parent authors
+	if status == models.CommentApproved {
+		for i := range changed {
+			if err := notifyComment(tx, &changed[i]); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	c.Flash().Add("success", fmt.Sprintf("%d comments were marked %s.", len(changed), status))
+	return c.Redirect(302, "/comments/moderation?status=%s", req.FormValue("From"))
+}
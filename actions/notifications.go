@@ -0,0 +1,166 @@
+package actions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/mailers"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// unsubscribePurpose is the purpose of the signed unsubscribe tokens.
+const unsubscribePurpose = "unsubscribe"
+
+// Background jobs delivering the notifications.
+const (
+	jobDeliverNotifications = "deliver_notifications"
+	jobSendDigests          = "send_digests"
+)
+
+// registerNotificationJobs registers the notification jobs on the worker
+// of the application.
+func registerNotificationJobs(w worker.Worker) error {
+	if err := w.Register(jobDeliverNotifications, func(worker.Args) error {
+		return deliverNotifications(time.Now())
+	}); err != nil {
+		return err
+	}
+	return w.Register(jobSendDigests, func(worker.Args) error {
+		return sendDigests(time.Now())
+	})
+}
+
+// notifyComment records the notifications of an approved comment and
+// asks the worker to deliver them, so the request does not wait for the
+// mail server.
+func notifyComment(tx *pop.Connection, comment *models.Comment) error {
+	if err := models.NotifyComment(tx, comment); err != nil {
+		return err
+	}
+	return jobQueue.PerformTx(tx, worker.Job{Handler: jobDeliverNotifications})
+}
+
+// deliverNotifications sends the instant notifications waiting. Those
+// that fail are put back in line.
+func deliverNotifications(now time.Time) error {
+	ns, err := models.ClaimInstantNotifications(models.DB, now)
+	if err != nil {
+		return err
+	}
+	items, err := ns.Items(models.DB)
+	if err != nil {
+		return err
+	}
+	failed := models.Notifications{}
+	for _, item := range items {
+		user := &models.User{}
+		if err := models.DB.Find(user, item.UserID); err != nil {
+			continue
+		}
+		link := unsubscribeLink(user, item.Kind, now)
+		if err := mailers.SendCommentNotification(user, item, App().Host, link); err != nil {
+			App().Logger.Errorf("notification to %s: %v", user.Email, err)
+			failed = append(failed, item.Notification)
+		}
+	}
+	return failed.Release(models.DB)
+}
+
+// sendDigests sends their digest to the users who are due one.
+func sendDigests(now time.Time) error {
+	users, err := models.DigestRecipients(models.DB, now)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		user := &users[i]
+		ns, err := user.ClaimDigest(models.DB, now)
+		if err != nil {
+			return err
+		}
+		items, err := ns.Items(models.DB)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		link := unsubscribeLink(user, "all", now)
+		if err := mailers.SendDigest(user, items, App().Host, link); err != nil {
+			App().Logger.Errorf("digest to %s: %v", user.Email, err)
+			if err := ns.Release(models.DB); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unsubscribeLink returns the link turning the notifications of kind off
+// for the user, "all" for every kind.
+func unsubscribeLink(user *models.User, kind string, now time.Time) string {
+	token := models.SignToken(unsubscribePurpose, user.ID.String()+":"+kind, now.AddDate(1, 0, 0))
+	return App().Host + "/notifications/unsubscribe/" + token
+}
+
+// NotificationsUnsubscribe turns notifications off from the link of an
+// email, without logging in. This function is mapped to the path
+// GET /notifications/unsubscribe/{token}
+func NotificationsUnsubscribe(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	subject, err := models.VerifySignedToken(unsubscribePurpose, c.Param("token"), time.Now())
+	parts := strings.SplitN(subject, ":", 2)
+	if err != nil || len(parts) != 2 {
+		c.Flash().Add("danger", "This unsubscribe link is invalid or has expired.")
+		return c.Redirect(302, "/")
+	}
+	user := &models.User{}
+	if err := tx.Find(user, parts[0]); err != nil {
+		return c.Error(404, err)
+	}
+
+	kinds := []string{parts[1]}
+	if parts[1] == "all" {
+		kinds = []string{models.NotificationComment, models.NotificationReply}
+	}
+	for _, kind := range kinds {
+		user.SetNotifyPreference(kind, models.NotifyOff)
+	}
+	if err := tx.Update(user); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "You will not get these emails anymore.")
+	return c.Redirect(302, "/")
+}
+
+// NotificationsUpdate saves the notification preferences of the user.
+// This function is mapped to the path PUT /users/{user_id}/notifications
+func NotificationsUpdate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	// Users can only manage their own notifications
+	user := currentUser(c)
+	if user.ID.String() != c.Param("user_id") {
+		return notAuthorized(c, "/")
+	}
+
+	req := c.Request()
+	user.SetNotifyPreference(models.NotificationComment, req.FormValue("NotifyComments"))
+	user.SetNotifyPreference(models.NotificationReply, req.FormValue("NotifyReplies"))
+	if err := tx.Update(user); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Your notification preferences were saved.")
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
@@ -0,0 +1,21 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (as *ActionSuite) Test_Notifications_Unsubscribe() {
+	user := as.createUser("subscriber", models.RoleAuthor)
+
+	link := unsubscribeLink(user, models.NotificationReply, time.Now())
+	res := as.HTML(link[len(App().Host):]).Get()
+	as.Equal(302, res.Code)
+	as.NoError(as.DB.Reload(user))
+	as.Equal(models.NotifyOff, user.NotifyPreference(models.NotificationReply))
+	as.Equal(models.NotifyInstant, user.NotifyPreference(models.NotificationComment))
+
+	res = as.HTML("/notifications/unsubscribe/forged").Get()
+	as.Equal(302, res.Code)
+}
@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// PasswordForgot renders the form asking for the email of a forgotten
+// account. This function is mapped to the path GET /password/forgot
+func PasswordForgot(c buffalo.Context) error {
+	return c.Render(200, r.HTML("users/forgot.html"))
+}
+
+// PasswordForgotPost emails a reset link to the account matching the
+// given email. The answer is the same whether the account exists or not.
+// This function is mapped to the path POST /password/forgot
+func PasswordForgotPost(c buffalo.Context) error {
+	// Get the DB connection from the context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user := &models.User{}
+	email := c.Request().FormValue("Email")
+	if err := tx.Where("email = ?", email).First(user); err == nil {
+		// The job issues the token of the reset, so it is created
+		// outside of the request for the job to find it
+		reset := &models.PasswordReset{}
+		if err := reset.Generate(models.DB, user, time.Now()); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := queueMail(tx, "mail_password_reset", user, reset.ID.String()); err != nil {
+			c.Logger().Errorf("password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.Flash().Add("success", "If an account uses this email, a link to reset its password was sent to it.")
+	return c.Redirect(302, "/login")
+}
+
+// PasswordReset renders the form to choose a new password. This function
+// is mapped to the path GET /password/reset/{token}
+func PasswordReset(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	if _, err := models.FindPasswordReset(tx, c.Param("token"), time.Now()); err != nil {
+		c.Flash().Add("danger", "This link is invalid or has expired, please ask for a new one.")
+		return c.Redirect(302, "/password/forgot")
+	}
+	c.Set("token", c.Param("token"))
+	return c.Render(200, r.HTML("users/reset.html"))
+}
+
+// PasswordResetPost changes the password of the account and uses up the
+// reset link. This function is mapped to the path
+// POST /password/reset/{token}
+func PasswordResetPost(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	reset, err := models.FindPasswordReset(tx, c.Param("token"), time.Now())
+	if err != nil {
+		c.Flash().Add("danger", "This link is invalid or has expired, please ask for a new one.")
+		return c.Redirect(302, "/password/forgot")
+	}
+
+	req := c.Request()
+	verrs, err := reset.Redeem(tx, req.FormValue("Password"), req.FormValue("PasswordConfirm"), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		c.Set("token", c.Param("token"))
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/reset.html"))
+	}
+
+	c.Flash().Add("success", "Your password was changed, you can now log in.")
+	return c.Redirect(302, "/login")
+}
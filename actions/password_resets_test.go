@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/sampalm/buffalo/blogapp/mailers"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// mailRecorder keeps the sent emails instead of delivering them.
+type mailRecorder struct {
+	messages []mail.Message
+}
+
+func (m *mailRecorder) Send(msg mail.Message) error {
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (as *ActionSuite) Test_PasswordReset() {
+	user := as.createUser("forgetful", models.RoleCommenter)
+	rec := &mailRecorder{}
+	sender := mailers.Sender
+	mailers.Sender = rec
+	defer func() { mailers.Sender = sender }()
+
+	res := as.HTML("/password/forgot").Post(map[string]string{"Email": "nobody@example.com"})
+	as.Equal(302, res.Code)
+	as.Len(rec.messages, 0)
+
+	res = as.HTML("/password/forgot").Post(map[string]string{"Email": user.Email})
+	as.Equal(302, res.Code)
+	as.Len(rec.messages, 1)
+	as.Equal([]string{user.Email}, rec.messages[0].To)
+
+	body := rec.messages[0].Bodies[0].Content
+	i := strings.Index(body, "/password/reset/")
+	as.True(i > 0)
+	path := strings.Fields(body[i:])[0]
+
+	res = as.HTML(path).Post(map[string]string{"Password": "new password", "PasswordConfirm": "other"})
+	as.Equal(422, res.Code)
+
+	res = as.HTML(path).Post(map[string]string{"Password": "new password", "PasswordConfirm": "new password"})
+	as.Equal(302, res.Code)
+	as.Equal("/login", res.Header().Get("Location"))
+
+	login := &models.User{Email: user.Email, Password: "new password"}
+	as.NoError(login.Authorize(as.DB))
+
+	res = as.HTML(path).Get()
+	as.Equal(302, res.Code)
+}
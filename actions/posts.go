@@ -1,7 +1,6 @@
 package actions
 
 import (
-	"database/sql"
 	"strconv"
 
 	"github.com/gobuffalo/buffalo"
@@ -10,6 +9,31 @@ import (
 	"github.com/sampalm/buffalo/blogapp/models"
 )
 
+// visiblePosts restricts q to the posts the current user is allowed to see.
+// Editors see every post, authors see their own drafts too and everyone
+// else only sees published ones.
+func visiblePosts(c buffalo.Context, q *pop.Query) *pop.Query {
+	user := currentUser(c)
+	switch {
+	case user.Can(models.PermPostViewDrafts):
+		return q
+	case user.Can(models.PermPostEditOwn):
+		return q.Where("(posts.status = ? OR posts.author_id = ?)", models.PostPublished, user.ID)
+	}
+	return q.Scope(models.PublishedPosts)
+}
+
+// listPosts orders q the way posts are listed on the blog and its feeds,
+// newest first. Drafts have no publication date and go by their creation.
+func listPosts(q *pop.Query) *pop.Query {
+	return q.Order("COALESCE(posts.published_at, posts.created_at) desc")
+}
+
+// canSeePost reports whether the current user is allowed to see post.
+func canSeePost(c buffalo.Context, post *models.Post) bool {
+	return currentUser(c).CanSeePost(post)
+}
+
 // PostsIndex default implementation.
 func PostsIndex(c buffalo.Context) error {
 	// Get the DB connection from contect
@@ -21,13 +45,20 @@ func PostsIndex(c buffalo.Context) error {
 
 	// Set paginate results. Params "page" and "per_page" control pagination.
 	q := tx.PaginateFromParams(c.Params())
-	// Query all Posts from the DB
-	if err := q.All(posts); err != nil {
+	// Query all visible Posts from the DB, newest first
+	if err := listPosts(visiblePosts(c, q)).All(posts); err != nil {
 		return errors.WithStack(err)
 	}
 
-	// Make posts available inside the html template
+	// Make posts and their thumbnails available inside the html template
 	c.Set("posts", posts)
+	names := []string{}
+	for _, p := range *posts {
+		names = append(names, p.FileName)
+	}
+	if err := setUploads(c, tx, names...); err != nil {
+		return errors.WithStack(err)
+	}
 	// Add the paginator to the context so it can be used in the html
 	c.Set("pagination", q.Paginator)
 
@@ -38,13 +69,10 @@ func PostsIndex(c buffalo.Context) error {
 func PostsCreateGet(c buffalo.Context) error {
 	tx := c.Value("tx").(*pop.Connection)
 
-	tags := &models.Tags{}
-	if err := tx.All(tags); err != nil {
-		errors.WithStack(err)
+	if err := setPostForm(c, tx, []int{}); err != nil {
+		return errors.WithStack(err)
 	}
-
-	c.Set("tags", tags)
-	c.Set("post", &models.Post{})
+	c.Set("post", &models.Post{Status: models.PostDraft})
 	return c.Render(200, r.HTML("posts/create.html"))
 }
 
@@ -65,6 +93,12 @@ func PostsCreatePost(c buffalo.Context) error {
 		return errors.WithStack(errors.New("transaction not found"))
 	}
 
+	// Get the selected tags from html form
+	codes, err := formTagCodes(c)
+	if err != nil {
+		return c.Error(400, err)
+	}
+
 	// Get FileImage from html form
 	f, err := c.File("FileImage")
 	if err != nil {
@@ -74,33 +108,49 @@ func PostsCreatePost(c buffalo.Context) error {
 
 	// Validate the data from html form
 	post.AuthorID = user.ID
-	veers, err := post.UploadAndCreate(tx)
+	veers, err := post.UploadAndCreate(tx, uploadLimits)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
 	if veers.HasAny() {
+		recordRejections(c, post)
+		if err := setPostForm(c, tx, codes); err != nil {
+			return errors.WithStack(err)
+		}
 		c.Set("post", post)
 		c.Set("errors", veers.Errors)
 		return c.Render(422, r.HTML("posts/create"))
 	}
 
-	// Validate the posts tag
-	if post.Tag != "" {
-		tag := &models.Tag{}
-		code, err := strconv.Atoi(post.Tag)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		if err := tx.Where("code = ?", code).First(tag); err != nil {
-			return errors.WithStack(err)
-		}
-		tagpost := &models.TagPost{}
-		tagpost.PostID = post.ID
-		tagpost.TagID = tag.ID
-		if err := tx.Save(tagpost); err != nil {
+	// The image gets its variants in the background
+	if err := processUpload(tx, post.FileName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The other images complete the gallery
+	veers, err = attachFiles(c, tx, post)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if veers.HasAny() {
+		recordRejections(c, post)
+		if err := setPostForm(c, tx, codes); err != nil {
 			return errors.WithStack(err)
 		}
+		c.Set("post", post)
+		c.Set("errors", veers.Errors)
+		return c.Render(422, r.HTML("posts/create"))
+	}
+
+	// Keep the first version of the post in its history
+	if err := post.Revise(tx, user.ID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Link the post to its tags
+	if err := post.SyncTags(tx, codes); err != nil {
+		return errors.WithStack(err)
 	}
 
 	// If there are no errors set a success message
@@ -121,23 +171,22 @@ func PostsEditGet(c buffalo.Context) error {
 	if err := tx.Find(post, c.Param("pid")); err != nil {
 		return c.Error(404, err)
 	}
-	// Get Tag from DB to html template
-	tag := &models.Tag{}
-	err := tx.Q().Where("tags.id = tags_posts.tag_id").LeftJoin("tags_posts", "tags_posts.post_id = ?", post.ID).First(tag)
+	if !currentUser(c).CanEditPost(post) {
+		return notAuthorized(c, "/posts")
+	}
+	// Get the Tags of the Post to html template
+	codes, err := post.TagCodes(tx)
 	if err != nil {
-		if errors.Cause(err) != sql.ErrNoRows {
-			return c.Error(404, err)
-		}
+		return errors.WithStack(err)
 	}
-	// Get All Tags from DB to html template
-	tags := &models.Tags{}
-	if err := tx.All(tags); err != nil {
-		return c.Error(404, err)
+	if err := setPostForm(c, tx, codes); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := setAttachments(c, tx, post); err != nil {
+		return errors.WithStack(err)
 	}
 
 	c.Set("post", post)
-	c.Set("post_tag", tag)
-	c.Set("tags", tags)
 	return c.Render(200, r.HTML("posts/edit.html"))
 }
 
@@ -154,12 +203,21 @@ func PostsEditPost(c buffalo.Context) error {
 	if err := tx.Find(post, c.Param("pid")); err != nil {
 		return c.Error(404, err)
 	}
+	if !currentUser(c).CanEditPost(post) {
+		return notAuthorized(c, "/posts")
+	}
 
 	// Bind post to the html form element
 	if err := c.Bind(post); err != nil {
 		return errors.WithStack(err)
 	}
 
+	// Get the selected tags from html form
+	codes, err := formTagCodes(c)
+	if err != nil {
+		return c.Error(400, err)
+	}
+
 	// Get file from file_input form
 	f, err := c.File("FileImage")
 	if err != nil {
@@ -167,49 +225,86 @@ func PostsEditPost(c buffalo.Context) error {
 	}
 	post.FileImage = f
 
-	// Try to update post data in the DB
-	verrs, err := post.UploadAndUpdated(tx)
+	// Apply the changes to the gallery, the cover becomes the post image
+	if err := post.EditAttachments(tx, formAttachmentEdits(c), c.Param("CoverID")); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Try to update post data in the DB, then add the new images
+	verrs, err := post.UploadAndUpdated(tx, uploadLimits)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if !verrs.HasAny() {
+		verrs, err = attachFiles(c, tx, post)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	if verrs.HasAny() {
+		recordRejections(c, post)
+		if err := setPostForm(c, tx, codes); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := setAttachments(c, tx, post); err != nil {
+			return errors.WithStack(err)
+		}
 		c.Set("post", post)
 		c.Set("errors", verrs.Errors)
 		return c.Render(422, r.HTML("posts/edit.html"))
 	}
 
-	// Try to update post tags
-	newTag := &models.Tag{}
-	if err = tx.Where("code = ?", post.Tag).First(newTag); err != nil {
-		return errors.WithStack(err)
-	}
-	pTag := &models.TagPost{}
-	err = tx.Q().LeftJoin("tags", "tags_posts.post_id = ?", post.ID).Where("tags.id = tags_posts.tag_id").First(pTag)
-	if err != nil {
-		// Pehaps the old tag was destroyed, generate a new one.
-		if errors.Cause(err) == sql.ErrNoRows {
-			tagpost := &models.TagPost{}
-			tagpost.PostID = post.ID
-			tagpost.TagID = newTag.ID
-			if err := tx.Save(tagpost); err != nil {
-				return errors.WithStack(err)
-			}
-			c.Flash().Add("success", "Post was updated successfully.")
-			return c.Redirect(302, "/posts/detail/%s", post.ID)
+	// A new image gets its variants in the background
+	if post.FileImage.Filename != "" {
+		if err := processUpload(tx, post.FileName); err != nil {
+			return errors.WithStack(err)
 		}
+	}
+
+	// Record the edit in the post history
+	user := c.Value("current_user").(*models.User)
+	if err := post.Revise(tx, user.ID); err != nil {
 		return errors.WithStack(err)
 	}
 
-	// If there are an old tag, just update it.
-	pTag.PostID = post.ID
-	pTag.TagID = newTag.ID
-	if err = tx.Update(pTag); err != nil {
+	// Add and remove tags to match the selection
+	if err := post.SyncTags(tx, codes); err != nil {
 		return errors.WithStack(err)
 	}
 
 	// If there are no errors set a success message
 	c.Flash().Add("success", "Post was updated successfully.")
-	return c.Redirect(302, "/posts/detail/%s", post.ID)
+	return c.Redirect(302, "/posts/detail/%s", post.Slug)
+}
+
+// setPostForm makes the tags and statuses available to the post form,
+// marking the tags with the given codes as selected.
+func setPostForm(c buffalo.Context, tx *pop.Connection, codes []int) error {
+	tags := &models.Tags{}
+	if err := tx.All(tags); err != nil {
+		return err
+	}
+	selected := map[int]bool{}
+	for _, code := range codes {
+		selected[code] = true
+	}
+	c.Set("tags", tags)
+	c.Set("post_tags", selected)
+	c.Set("statuses", models.PostStatuses)
+	return nil
+}
+
+// formTagCodes reads the codes of the tags selected in the post form.
+func formTagCodes(c buffalo.Context) ([]int, error) {
+	codes := []int{}
+	for _, v := range c.Request().Form["TagCodes"] {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
 }
 
 // PostsDelete default implementation.
@@ -225,16 +320,22 @@ func PostsDelete(c buffalo.Context) error {
 	if err := tx.Find(post, c.Param("pid")); err != nil {
 		return c.Error(404, err)
 	}
+	if !currentUser(c).CanEditPost(post) {
+		return notAuthorized(c, "/posts")
+	}
 
 	// Try to exclude post from DB
 	if err := tx.Destroy(post); err != nil {
 		return errors.WithStack(err)
 	}
 
-	// Try to exclude image from disk
+	// Release the image, the file goes once no post uses it
 	if err := post.DeleteFile(tx); err != nil {
 		return errors.WithStack(err)
 	}
+	if err := collectUploads(tx); err != nil {
+		return errors.WithStack(err)
+	}
 
 	c.Flash().Add("success", "Post was successfully deleted.")
 	return c.Redirect(302, "/posts")
@@ -248,11 +349,18 @@ func PostsDetail(c buffalo.Context) error {
 		return errors.WithStack(errors.New("transaction not found"))
 	}
 
-	// To find the Post the parameter pid is used
-	post := &models.Post{}
-	if err := tx.Find(post, c.Param("pid")); err != nil {
+	// To find the Post the parameter pid is used, it holds the post slug
+	post, canonical, err := models.FindPostBySlug(tx, c.Param("pid"))
+	if err != nil {
 		return c.Error(404, err)
 	}
+	if !canSeePost(c, post) {
+		return c.Error(404, errors.New("post not published"))
+	}
+	// Old and renamed urls are moved to the current slug
+	if !canonical {
+		return c.Redirect(301, "/posts/detail/%s", post.Slug)
+	}
 
 	// To find the Post Author the parameter AuthorID is used
 	author := &models.User{}
@@ -262,7 +370,7 @@ func PostsDetail(c buffalo.Context) error {
 
 	// Find the posts tags
 	tags := &models.Tags{}
-	err := tx.Q().Where("tags.id = tags_posts.tag_id").LeftJoin("tags_posts", "tags_posts.post_id = ?", post.ID).All(tags)
+	err = tx.Q().Where("tags.id = tags_posts.tag_id").LeftJoin("tags_posts", "tags_posts.post_id = ?", post.ID).All(tags)
 	if err != nil {
 		return c.Error(404, err)
 	}
@@ -271,12 +379,16 @@ func PostsDetail(c buffalo.Context) error {
 	c.Set("post", post)
 	c.Set("author", author)
 	c.Set("tags", tags)
+	if err := setAttachments(c, tx, post); err != nil {
+		return errors.WithStack(err)
+	}
 
 	// Get the comments for this posts
 	comment := &models.Comment{}
 	c.Set("comment", comment)
 	comments := models.Comments{}
-	if err := tx.BelongsTo(post).All(&comments); err != nil {
+	q := models.VisibleComments(tx.BelongsTo(post), currentUser(c))
+	if err := q.Order("created_at asc").All(&comments); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -288,6 +400,6 @@ func PostsDetail(c buffalo.Context) error {
 		}
 		comments[i].Author = u
 	}
-	c.Set("comments", comments)
+	c.Set("comments", models.ThreadComments(comments, commentsMaxDepth))
 	return c.Render(200, r.HTML("posts/detail.html"))
 }
@@ -1,5 +1,13 @@
 package actions
 
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
 func (as *ActionSuite) Test_Posts_Index() {
 	as.Fail("Not Implemented!")
 }
@@ -19,3 +27,52 @@ func (as *ActionSuite) Test_Posts_Delete() {
 func (as *ActionSuite) Test_Posts_Detail() {
 	as.Fail("Not Implemented!")
 }
+
+func (as *ActionSuite) Test_Posts_Index_HidesDrafts() {
+	published := &models.Post{Title: "Published post", Slug: "published-post", Content: "hello", Status: models.PostPublished}
+	as.NoError(as.DB.Create(published))
+	draft := &models.Post{Title: "Draft post", Slug: "draft-post", Content: "hello", Status: models.PostDraft}
+	as.NoError(as.DB.Create(draft))
+
+	res := as.HTML("/posts").Get()
+	as.Equal(200, res.Code)
+	as.Contains(res.Body.String(), "Published post")
+	as.NotContains(res.Body.String(), "Draft post")
+
+	res = as.HTML("/posts/detail/%s", draft.ID).Get()
+	as.Equal(404, res.Code)
+}
+
+func (as *ActionSuite) Test_Posts_Index_OrdersDraftsByCreation() {
+	editor := as.createUser("editor", models.RoleEditor)
+	draft := &models.Post{Title: "Older draft", Slug: "older-draft", Content: "hello", AuthorID: editor.ID, Status: models.PostDraft}
+	as.NoError(as.DB.Create(draft))
+	published := &models.Post{Title: "Newer post", Slug: "newer-post", Content: "hello", AuthorID: editor.ID,
+		Status: models.PostPublished, PublishedAt: nulls.NewTime(time.Now().Add(time.Minute))}
+	as.NoError(as.DB.Create(published))
+
+	res := as.HTML("/login").Post(map[string]string{"Email": editor.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+	res = as.HTML("/posts").Get()
+	as.Equal(200, res.Code)
+	body := res.Body.String()
+	as.Contains(body, "Older draft")
+	as.True(strings.Index(body, "Newer post") < strings.Index(body, "Older draft"))
+}
+
+func (as *ActionSuite) Test_Posts_Detail_RedirectsToSlug() {
+	post := &models.Post{Title: "Hello World", Slug: "hello-world", Content: "hello", Status: models.PostPublished}
+	as.NoError(as.DB.Create(post))
+	as.NoError(as.DB.Create(&models.PostSlug{PostID: post.ID, Slug: "hello"}))
+
+	res := as.HTML("/posts/detail/hello-world").Get()
+	as.Equal(200, res.Code)
+
+	res = as.HTML("/posts/detail/%s", post.ID).Get()
+	as.Equal(301, res.Code)
+	as.Equal("/posts/detail/hello-world", res.Header().Get("Location"))
+
+	res = as.HTML("/posts/detail/hello").Get()
+	as.Equal(301, res.Code)
+	as.Equal("/posts/detail/hello-world", res.Header().Get("Location"))
+}
@@ -1,10 +1,18 @@
 package actions
 
 import (
+	"time"
+
 	"github.com/gobuffalo/buffalo/render"
 	"github.com/gobuffalo/packr"
+	"github.com/gobuffalo/plush"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"github.com/sampalm/buffalo/blogapp/storage"
 )
 
+// imageURLExpiry is how long the links to private images last.
+const imageURLExpiry = 6 * time.Hour
+
 var r *render.Engine
 var assetsBox = packr.NewBox("../public")
 
@@ -22,6 +30,49 @@ func init() {
 			// uncomment for non-Bootstrap form helpers:
 			// "form":     plush.FormHelper,
 			// "form_for": plush.FormForHelper,
+			"can":              canHelper,
+			"canEditPost":      canEditPostHelper,
+			"canDeleteComment": canDeleteCommentHelper,
+			"authProviders":    func() []string { return authProviders },
+			"imageURL":         imageURL,
+			"imageTag":         imageTagHelper,
+			"srcset":           srcsetHelper,
+			"postContent":      postContentHelper,
+			"stripShortcodes":  models.StripShortcodes,
 		},
 	})
 }
+
+// helperUser returns the signed in user of a template, nil for visitors.
+func helperUser(help plush.HelperContext) *models.User {
+	user, _ := help.Value("current_user").(*models.User)
+	return user
+}
+
+// canHelper reports whether the current user has the permission perm.
+func canHelper(perm string, help plush.HelperContext) bool {
+	return helperUser(help).Can(models.Permission(perm))
+}
+
+// canEditPostHelper reports whether the current user can edit the post.
+func canEditPostHelper(post *models.Post, help plush.HelperContext) bool {
+	return helperUser(help).CanEditPost(post)
+}
+
+// canDeleteCommentHelper reports whether the current user can delete the
+// comment.
+func canDeleteCommentHelper(comment models.Comment, help plush.HelperContext) bool {
+	return helperUser(help).CanDeleteComment(&comment)
+}
+
+// imageURL returns the link to an uploaded image, from the storage.
+func imageURL(name string) string {
+	if name == "" {
+		return ""
+	}
+	u, err := storage.Default.URL(name, imageURLExpiry)
+	if err != nil {
+		return ""
+	}
+	return u
+}
@@ -0,0 +1,105 @@
+package actions
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// PostsRevisions GET implementation. Lists the revisions of a post and
+// shows the diff between the revisions given by the "from" and "to"
+// params, by default the two latest ones.
+func PostsRevisions(c buffalo.Context) error {
+	// Get the DB connection from context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	post := &models.Post{}
+	if err := tx.Find(post, c.Param("pid")); err != nil {
+		return c.Error(404, err)
+	}
+	if !currentUser(c).CanEditPost(post) {
+		return notAuthorized(c, "/posts")
+	}
+
+	// Newest revisions first
+	revisions := models.PostRevisions{}
+	if err := tx.Where("post_id = ?", post.ID).Order("created_at desc").All(&revisions); err != nil {
+		return errors.WithStack(err)
+	}
+	for i := range revisions {
+		if err := tx.Find(&revisions[i].Author, revisions[i].AuthorID); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// Pick the revisions to compare
+	from, to := findRevision(revisions, c.Param("from")), findRevision(revisions, c.Param("to"))
+	if to == nil && len(revisions) > 0 {
+		to = &revisions[0]
+	}
+	if from == nil && len(revisions) > 1 {
+		from = &revisions[1]
+	}
+	diff := []models.DiffLine{}
+	fromID, toID := "", ""
+	if from != nil && to != nil {
+		diff = models.DiffLines(from.Title+"\n\n"+from.Content, to.Title+"\n\n"+to.Content)
+		fromID, toID = from.ID.String(), to.ID.String()
+	}
+
+	c.Set("post", post)
+	c.Set("revisions", revisions)
+	c.Set("from_id", fromID)
+	c.Set("to_id", toID)
+	c.Set("diff", diff)
+	return c.Render(200, r.HTML("posts/revisions.html"))
+}
+
+// PostsRevisionsRestore POST implementation. Restores an old revision,
+// which is recorded as a new revision.
+func PostsRevisionsRestore(c buffalo.Context) error {
+	// Get the DB connection from context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	post := &models.Post{}
+	if err := tx.Find(post, c.Param("pid")); err != nil {
+		return c.Error(404, err)
+	}
+	if !currentUser(c).CanEditPost(post) {
+		return notAuthorized(c, "/posts")
+	}
+	rev := &models.PostRevision{}
+	if err := tx.Where("post_id = ?", post.ID).Find(rev, c.Param("rid")); err != nil {
+		return c.Error(404, err)
+	}
+
+	user := c.Value("current_user").(*models.User)
+	verrs, err := rev.Restore(tx, post, user.ID)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		c.Flash().Add("danger", "This revision could not be restored.")
+		return c.Redirect(302, "/posts/revisions/%s", post.ID)
+	}
+
+	c.Flash().Add("success", "Revision was restored successfully.")
+	return c.Redirect(302, "/posts/detail/%s", post.Slug)
+}
+
+// findRevision returns the revision with the given id, or nil.
+func findRevision(revisions models.PostRevisions, id string) *models.PostRevision {
+	for i := range revisions {
+		if revisions[i].ID.String() == id {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
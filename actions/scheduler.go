@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// schedulerInterval controls how often the scheduler looks for due work.
+var schedulerInterval = time.Minute
+
+// sweepInterval controls how often the stored files are swept.
+var sweepInterval = time.Hour
+
+// startScheduler runs the periodic tasks of the application, like
+// publishing scheduled posts, until ctx is done.
+func startScheduler(ctx context.Context, app *buffalo.App) {
+	ticker := time.NewTicker(schedulerInterval)
+	sweeper := time.NewTicker(sweepInterval)
+	go func() {
+		defer ticker.Stop()
+		defer sweeper.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sweeper.C:
+				// Files left behind by failed requests
+				if err := app.Worker.Perform(worker.Job{Handler: jobSweepUploads}); err != nil {
+					app.Logger.Errorf("could not queue the upload sweep: %v", err)
+				}
+			case now := <-ticker.C:
+				if err := models.PublishDuePosts(models.DB, now); err != nil {
+					app.Logger.Errorf("could not publish scheduled posts: %v", err)
+				}
+				if err := app.Worker.Perform(worker.Job{Handler: jobSendDigests}); err != nil {
+					app.Logger.Errorf("could not queue digests: %v", err)
+				}
+				// Images replaced by an edit wait for this collection
+				if err := app.Worker.Perform(worker.Job{Handler: jobCollectUploads}); err != nil {
+					app.Logger.Errorf("could not queue the upload collection: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// SearchIndex GET implementation. Searches the posts and their comments for
+// the "q" param.
+func SearchIndex(c buffalo.Context) error {
+	// Get the DB connection from context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	term := strings.TrimSpace(c.Param("q"))
+	c.Set("q", term)
+	if term == "" {
+		c.Set("results", models.SearchResults{})
+		c.Set("pagination", nil)
+		return c.Render(200, r.HTML("search/index.html"))
+	}
+
+	// Editors can find drafts too
+	includeDrafts := currentUser(c).Can(models.PermPostViewDrafts)
+
+	results, paginator, err := models.SearchPosts(tx, term, includeDrafts, c.Params())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Set("results", results)
+	c.Set("pagination", paginator)
+	return c.Render(200, r.HTML("search/index.html"))
+}
@@ -0,0 +1,15 @@
+package actions
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (as *ActionSuite) Test_Search_Index() {
+	post := &models.Post{Title: "Buffalo tips", Slug: "buffalo-tips", Content: "Write handlers in Go", Status: models.PostPublished}
+	as.NoError(as.DB.Create(post))
+	draft := &models.Post{Title: "Buffalo secrets", Slug: "buffalo-secrets", Content: "Not ready", Status: models.PostDraft}
+	as.NoError(as.DB.Create(draft))
+
+	res := as.HTML("/search?q=buffalo").Get()
+	as.Equal(200, res.Code)
+	as.Contains(res.Body.String(), "Buffalo tips")
+	as.NotContains(res.Body.String(), "Buffalo secrets")
+}
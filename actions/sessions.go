@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// startSession logs the user in on this device once every check passed.
+func startSession(c buffalo.Context, user *models.User) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	if err := loginSucceeded(user); err != nil {
+		return errors.WithStack(err)
+	}
+	session, err := models.StartSession(tx, user, clientIP(c), c.Request().UserAgent(), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Session().Set("current_user_id", user.ID)
+	c.Session().Set("session_id", session.ID)
+	c.Flash().Add("success", fmt.Sprintf("Hello %s, Welcome back!", user.Name))
+	return c.Redirect(302, "/")
+}
+
+// endSession revokes the session of this device.
+func endSession(c buffalo.Context) error {
+	user := currentUser(c)
+	if user == nil {
+		return nil
+	}
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	return user.RevokeSession(tx, currentSessionID(c).String(), time.Now())
+}
+
+// currentSessionID returns the id of the session of this device, or
+// uuid.Nil.
+func currentSessionID(c buffalo.Context) uuid.UUID {
+	if s, ok := c.Value("current_session").(*models.Session); ok {
+		return s.ID
+	}
+	return uuid.Nil
+}
+
+// SessionsDestroy signs one of the devices of the user out. This function
+// is mapped to the path DELETE /users/{user_id}/sessions/{session_id}
+func SessionsDestroy(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	// Users can only manage their own sessions
+	user := currentUser(c)
+	if user.ID.String() != c.Param("user_id") {
+		return notAuthorized(c, "/")
+	}
+
+	if err := user.RevokeSession(tx, c.Param("session_id"), time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+	if c.Param("session_id") == currentSessionID(c).String() {
+		c.Session().Clear()
+		c.Flash().Add("success", "Goodbye!")
+		return c.Redirect(302, "/")
+	}
+	c.Flash().Add("success", "The session was signed out.")
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
+
+// SessionsDestroyOthers signs every other device of the user out. This
+// function is mapped to the path DELETE /users/{user_id}/sessions
+func SessionsDestroyOthers(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	user := currentUser(c)
+	if user.ID.String() != c.Param("user_id") {
+		return notAuthorized(c, "/")
+	}
+
+	if err := user.RevokeOtherSessions(tx, currentSessionID(c), time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "All your other sessions were signed out.")
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
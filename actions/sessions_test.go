@@ -0,0 +1,15 @@
+package actions
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (as *ActionSuite) Test_Login_Starts_Session() {
+	user := as.createUser("traveller", models.RoleCommenter)
+
+	res := as.HTML("/login").Post(map[string]string{"Email": user.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+
+	sessions, err := user.ActiveSessions(as.DB)
+	as.NoError(err)
+	as.Len(sessions, 1)
+	as.Equal("Unknown browser", sessions[0].Device)
+}
@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// adminSetting is a switch of the admin settings page.
+type adminSetting struct {
+	Key   string
+	Label string
+	On    bool
+}
+
+// adminSettings lists the switches of the admin settings page.
+var adminSettings = []adminSetting{
+	{Key: models.SettingRequireAdmin2FA, Label: "Require two-factor authentication for admins"},
+	{Key: models.SettingFirstCommentApproval, Label: "Hold the first comment of each user for approval"},
+}
+
+// SettingsIndex shows the site wide settings. This function is mapped to
+// the path GET /admin/settings
+func SettingsIndex(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	settings := make([]adminSetting, len(adminSettings))
+	for i, s := range adminSettings {
+		on, err := models.SettingOn(tx, s.Key)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		s.On = on
+		settings[i] = s
+	}
+	c.Set("settings", settings)
+	return c.Render(200, r.HTML("settings/index.html"))
+}
+
+// SettingsUpdate saves the site wide settings. This function is mapped to
+// the path PUT /admin/settings
+func SettingsUpdate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	for _, s := range adminSettings {
+		value := "false"
+		if c.Request().FormValue(s.Key) == "true" {
+			value = "true"
+		}
+		if err := models.SaveSetting(tx, s.Key, value); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	c.Flash().Add("success", "Settings were saved.")
+	return c.Redirect(302, "/admin/settings")
+}
@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// spamHoneypot is the comment form field hidden from people.
+const spamHoneypot = "Website"
+
+// spamChecker scores new comments. The heuristics are set from
+// SPAM_MAX_LINKS, SPAM_BLOCKED_WORDS, SPAM_BLOCKED_DOMAINS and
+// SPAM_MAX_PER_HOUR, Akismet is used when AKISMET_KEY is set. AKISMET_URL
+// points it at another compatible service.
+var spamChecker models.SpamChecker = newSpamChecker()
+
+func newSpamChecker() models.SpamChecker {
+	checkers := models.SpamCheckers{
+		models.HoneypotChecker{},
+		models.LinkChecker{Max: envInt("SPAM_MAX_LINKS", 2, 1)},
+		models.BlocklistChecker{
+			Words:   envList("SPAM_BLOCKED_WORDS"),
+			Domains: envList("SPAM_BLOCKED_DOMAINS"),
+		},
+		models.VelocityChecker{Max: envInt("SPAM_MAX_PER_HOUR", 10, 1), Window: time.Hour},
+	}
+	if key := envy.Get("AKISMET_KEY", ""); key != "" {
+		checkers = append(checkers, models.NewAkismetChecker(key, App().Host, envy.Get("AKISMET_URL", "")))
+	}
+	return checkers
+}
+
+// envList reads a comma separated list from the environment.
+func envList(key string) []string {
+	list := []string{}
+	for _, v := range strings.Split(envy.Get(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// checkSpam scores the new comment of user and sends it to the spam
+// queue when it looks like spam. Moderators are trusted. A failing
+// checker is logged, the comment is judged by the others.
+func checkSpam(c buffalo.Context, tx *pop.Connection, comment *models.Comment, user *models.User) {
+	if user.Can(models.PermCommentModerate) {
+		return
+	}
+	req := c.Request()
+	verdict, err := spamChecker.Check(tx, models.SpamInput{
+		Comment:   comment,
+		Author:    user,
+		IP:        clientIP(c),
+		UserAgent: req.UserAgent(),
+		Referrer:  req.Referer(),
+		Permalink: App().Host + "/posts/detail/" + c.Param("pid"),
+		Honeypot:  req.FormValue(spamHoneypot),
+	})
+	if err != nil {
+		c.Logger().Errorf("spam check: %v", err)
+	}
+	comment.SpamScore = verdict.Score
+	comment.SpamReason = verdict.Reason
+	if verdict.IsSpam() {
+		comment.Status = models.CommentSpam
+	}
+}
@@ -25,12 +25,13 @@ func TagsShow(c buffalo.Context) error {
 	posts := &models.Posts{}
 
 	q := tx.PaginateFromParams(c.Params())
-	err := q.Where("posts.id = tags_posts.post_id").LeftJoin("tags_posts", "tags_posts.tag_id = ?", tag.ID).All(posts)
+	err := listPosts(tagPosts(visiblePosts(c, q), tag)).All(posts)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
 	// Make posts available inside the html template
+	c.Set("tag", tag)
 	c.Set("posts", posts)
 	// Add pagination to the html
 	c.Set("pagination", q.Paginator)
@@ -38,6 +39,11 @@ func TagsShow(c buffalo.Context) error {
 	return c.Render(200, r.HTML("posts/tags.html"))
 }
 
+// tagPosts restricts q to the posts of tag.
+func tagPosts(q *pop.Query, tag *models.Tag) *pop.Query {
+	return q.Where("posts.id = tags_posts.post_id").LeftJoin("tags_posts", "tags_posts.tag_id = ?", tag.ID)
+}
+
 // TagsCreate GET implementation
 func TagsCreateGet(c buffalo.Context) error {
 	c.Set("tag", &models.Tag{})
@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// TokensCreate POST implementation. Mints a personal access token for the
+// current user, the token is only shown once.
+func TokensCreate(c buffalo.Context) error {
+	// Get the DB connection from the context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	// Users can only manage their own tokens
+	user := c.Value("current_user").(*models.User)
+	if user.ID.String() != c.Param("user_id") {
+		c.Flash().Add("danger", "You are not authorized to view that page.")
+		return c.Redirect(302, "/")
+	}
+
+	req := c.Request()
+	token := &models.AccessToken{UserID: user.ID, Name: req.FormValue("Name")}
+	expiresIn := time.Duration(0)
+	if days, err := strconv.Atoi(req.FormValue("ExpiresIn")); err == nil && days > 0 {
+		expiresIn = time.Duration(days) * 24 * time.Hour
+	}
+	verrs, err := token.Generate(tx, req.Form["Scopes"], expiresIn)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		for _, msgs := range verrs.Errors {
+			for _, msg := range msgs {
+				c.Flash().Add("danger", msg)
+			}
+		}
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+
+	// The clear token is only shown in this answer, never stored
+	if err := setUserEdit(c, tx, user); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("user", user)
+	c.Set("new_token", token)
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Render(200, r.HTML("users/edit.html"))
+}
+
+// TokensDestroy DELETE implementation. Revokes a personal access token.
+func TokensDestroy(c buffalo.Context) error {
+	// Get the DB connection from the context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user := c.Value("current_user").(*models.User)
+	token := &models.AccessToken{}
+	if err := tx.Where("user_id = ?", user.ID).Find(token, c.Param("token_id")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := tx.Destroy(token); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", fmt.Sprintf("Token %s was revoked.", token.Name))
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
+
+// SetCurrentUserFromToken attempts to find a user based on the personal
+// access token of the Authorization header. If one is found it is set on
+// the context, like SetCurrentUser does with the session.
+func SetCurrentUserFromToken(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		raw := bearerToken(c)
+		if !models.IsAccessToken(raw) {
+			return next(c)
+		}
+		tx := c.Value("tx").(*pop.Connection)
+		token, err := models.FindAccessToken(tx, raw)
+		if err != nil {
+			return renderAPIError(c, 401, "Invalid or expired token.", nil)
+		}
+		u := &models.User{}
+		if err := tx.Find(u, token.UserID); err != nil {
+			return renderAPIError(c, 401, "Invalid or expired token.", nil)
+		}
+		// Failed requests are rolled back, record the use outside of them
+		if err := token.Touch(models.DB, time.Now()); err != nil {
+			return errors.WithStack(err)
+		}
+		c.Set("current_user", u)
+		c.Set("current_token", token)
+		return next(c)
+	}
+}
+
+// APIScopeRequired requires personal access tokens to carry scope. Other
+// kinds of authentication are not restricted.
+func APIScopeRequired(scope string, next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if token, ok := c.Value("current_token").(*models.AccessToken); ok && !token.HasScope(scope) {
+			return renderAPIError(c, 403, fmt.Sprintf("This token lacks the %s scope.", scope), nil)
+		}
+		return next(c)
+	}
+}
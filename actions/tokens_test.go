@@ -0,0 +1,33 @@
+package actions
+
+import (
+	"fmt"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (as *ActionSuite) Test_Tokens_OnlyShownToOwner() {
+	owner := as.createUser("owner", models.RoleCommenter)
+	other := as.createUser("other", models.RoleCommenter)
+	path := fmt.Sprintf("/users/%s/edit", owner.ID)
+
+	res := as.HTML(path).Get()
+	as.Equal(302, res.Code)
+
+	res = as.HTML("/login").Post(map[string]string{"Email": other.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+	res = as.HTML(path).Get()
+	as.Equal(302, res.Code)
+	as.Equal("/", res.Header().Get("Location"))
+
+	res = as.HTML("/login").Post(map[string]string{"Email": owner.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+	res = as.HTML("/users/%s/tokens", owner.ID).Post(map[string]interface{}{"Name": "deploy", "Scopes": models.ScopeRead})
+	as.Equal(200, res.Code)
+
+	tokens := models.AccessTokens{}
+	as.NoError(as.DB.Where("user_id = ?", owner.ID).All(&tokens))
+	as.Len(tokens, 1)
+	as.Contains(res.Body.String(), "won't be shown again")
+	as.NotContains(res.Header().Get("Set-Cookie"), "deploy")
+}
@@ -0,0 +1,213 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// twoFactorIssuer names the application in authenticator apps.
+var twoFactorIssuer = envy.Get("TOTP_ISSUER", "Blogapp")
+
+// TwoFactorLogin asks for the second factor of a user whose password was
+// checked. This function is mapped to the path GET /login/two_factor
+func TwoFactorLogin(c buffalo.Context) error {
+	if c.Session().Get("pending_user_id") == nil {
+		return c.Redirect(302, "/login")
+	}
+	return c.Render(200, r.HTML("users/two_factor.html"))
+}
+
+// TwoFactorLoginPost checks a TOTP or recovery code and logs the pending
+// user in. This function is mapped to the path POST /login/two_factor
+func TwoFactorLoginPost(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+
+	uid := c.Session().Get("pending_user_id")
+	if uid == nil {
+		return c.Redirect(302, "/login")
+	}
+	user := &models.User{}
+	if err := tx.Find(user, uid); err != nil {
+		c.Session().Delete("pending_user_id")
+		return c.Redirect(302, "/login")
+	}
+
+	// Codes are guessed like passwords, slow it down the same way
+	wait, err := loginWait(c, user.Email)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if wait != "" {
+		verrs := validate.NewErrors()
+		verrs.Add("Code", wait)
+		c.Set("errors", verrs.Errors)
+		return c.Render(429, r.HTML("users/two_factor.html"))
+	}
+
+	ok, err := user.VerifySecondFactor(tx, c.Request().FormValue("Code"), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		if err := loginFailed(c, user.Email); err != nil {
+			return errors.WithStack(err)
+		}
+		verrs := validate.NewErrors()
+		verrs.Add("Code", "Invalid authentication code.")
+		c.Set("errors", verrs.Errors)
+		return c.Render(422, r.HTML("users/two_factor.html"))
+	}
+
+	c.Session().Delete("pending_user_id")
+	return startSession(c, user)
+}
+
+// twoFactorOwner returns the current user if they manage the two-factor
+// authentication of their own account.
+func twoFactorOwner(c buffalo.Context) (*models.User, bool) {
+	user := currentUser(c)
+	return user, user.ID.String() == c.Param("user_id")
+}
+
+// TwoFactorCreate gives the user a new TOTP secret to add to their
+// authenticator app. This function is mapped to the path
+// POST /users/{user_id}/two_factor
+func TwoFactorCreate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	user, ok := twoFactorOwner(c)
+	if !ok {
+		return notAuthorized(c, "/")
+	}
+	if user.HasTwoFactor() {
+		c.Flash().Add("info", "Two-factor authentication is already enabled.")
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+
+	if err := user.StartTwoFactor(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("info", "Add the secret to your authenticator app, then confirm with a code.")
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
+
+// TwoFactorUpdate confirms the pending secret with a code and shows the
+// recovery codes. This function is mapped to the path
+// PUT /users/{user_id}/two_factor
+func TwoFactorUpdate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	user, ok := twoFactorOwner(c)
+	if !ok {
+		return notAuthorized(c, "/")
+	}
+
+	ok, err := user.EnableTwoFactor(tx, c.Request().FormValue("Code"), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		c.Flash().Add("danger", "That code is not valid, check the clock of your device and try again.")
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+	return renderRecoveryCodes(c, tx, user)
+}
+
+// TwoFactorDestroy turns two-factor authentication off, given a valid
+// code. This function is mapped to the path
+// DELETE /users/{user_id}/two_factor
+func TwoFactorDestroy(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	user, ok := twoFactorOwner(c)
+	if !ok {
+		return notAuthorized(c, "/")
+	}
+
+	ok, err := user.VerifySecondFactor(tx, c.Request().FormValue("Code"), time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !ok {
+		c.Flash().Add("danger", "That code is not valid.")
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+	if err := user.DisableTwoFactor(tx); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Flash().Add("success", "Two-factor authentication is now disabled.")
+	return c.Redirect(302, "/users/%s/edit", user.ID)
+}
+
+// RecoveryCodesCreate replaces the recovery codes of the user. This
+// function is mapped to the path POST /users/{user_id}/recovery_codes
+func RecoveryCodesCreate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("transaction not found"))
+	}
+	user, ok := twoFactorOwner(c)
+	if !ok || !user.HasTwoFactor() {
+		return notAuthorized(c, "/")
+	}
+	return renderRecoveryCodes(c, tx, user)
+}
+
+// renderRecoveryCodes generates new recovery codes and shows them once.
+func renderRecoveryCodes(c buffalo.Context, tx *pop.Connection, user *models.User) error {
+	codes, err := models.GenerateRecoveryCodes(tx, user)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("user", user)
+	c.Set("codes", codes)
+	return c.Render(200, r.HTML("users/recovery_codes.html"))
+}
+
+// twoFactorMissing reports whether the user is an admin who must turn on
+// two-factor authentication before going on.
+func twoFactorMissing(c buffalo.Context, user *models.User) (bool, error) {
+	if !user.IsAdmin() || user.HasTwoFactor() {
+		return false, nil
+	}
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return false, errors.WithStack(errors.New("transaction not found"))
+	}
+	return models.SettingOn(tx, models.SettingRequireAdmin2FA)
+}
+
+// TwoFactorEnforced keeps admins without two-factor authentication on
+// their account page when the site requires it.
+func TwoFactorEnforced(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		user := currentUser(c)
+		missing, err := twoFactorMissing(c, user)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		path := c.Request().URL.Path
+		if !missing || path == "/logout" || strings.HasPrefix(path, fmt.Sprintf("/users/%s/", user.ID)) {
+			return next(c)
+		}
+		c.Flash().Add("warning", "Admins must enable two-factor authentication first.")
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+}
@@ -0,0 +1,291 @@
+package actions
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/binding"
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/plush"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/imaging"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"github.com/shurcooL/github_flavored_markdown"
+)
+
+// uploadLimits bounds the images of the posts. UPLOAD_MAX_BYTES sets the
+// largest file, UPLOAD_MAX_WIDTH and UPLOAD_MAX_HEIGHT the largest image
+// in pixels, UPLOAD_MAX_FILES the most images attached at once. Zero
+// disables a limit.
+var uploadLimits = models.UploadLimits{
+	MaxBytes:  int64(envInt("UPLOAD_MAX_BYTES", 10<<20, 0)),
+	MaxWidth:  envInt("UPLOAD_MAX_WIDTH", 8000, 0),
+	MaxHeight: envInt("UPLOAD_MAX_HEIGHT", 8000, 0),
+	MaxFiles:  envInt("UPLOAD_MAX_FILES", 10, 0),
+}
+
+// Background jobs handling the uploaded files.
+const (
+	jobCollectUploads = "collect_uploads"
+	jobProcessUpload  = "process_upload"
+	jobSweepUploads   = "sweep_uploads"
+)
+
+// uploadSweepAge is how old files must be to be swept, long enough for
+// the requests storing them to commit.
+const uploadSweepAge = time.Hour
+
+// registerUploadJobs registers the upload jobs on the worker of the
+// application.
+func registerUploadJobs(w worker.Worker) error {
+	if err := w.Register(jobProcessUpload, func(args worker.Args) error {
+		return models.ProcessUpload(models.DB, fmt.Sprint(args["key"]), time.Now())
+	}); err != nil {
+		return err
+	}
+	if err := w.Register(jobCollectUploads, func(worker.Args) error {
+		_, err := models.CollectUploads(models.DB)
+		return err
+	}); err != nil {
+		return err
+	}
+	return w.Register(jobSweepUploads, func(worker.Args) error {
+		_, err := models.SweepUploads(models.DB, time.Now().Add(-uploadSweepAge))
+		return err
+	})
+}
+
+// processUpload asks the worker to make the variants of an uploaded
+// image, once tx is committed.
+func processUpload(tx *pop.Connection, key string) error {
+	return jobQueue.PerformTx(tx, worker.Job{
+		Handler: jobProcessUpload,
+		Args:    worker.Args{"key": key},
+	})
+}
+
+// collectUploads asks the worker to remove the files released by tx,
+// once it is committed.
+func collectUploads(tx *pop.Connection) error {
+	return jobQueue.PerformTx(tx, worker.Job{Handler: jobCollectUploads})
+}
+
+// recordRejections keeps the images refused by the post form in the audit
+// log. They are written outside of the request transaction, which is
+// rolled back with the form.
+func recordRejections(c buffalo.Context, post *models.Post) {
+	for _, rejection := range post.Rejections {
+		rejection.IP = clientIP(c)
+		if err := rejection.Record(models.DB); err != nil {
+			c.Logger().Errorf("could not record the rejected upload: %v", err)
+		}
+	}
+}
+
+// setUploads makes the uploads of the images named by names available to
+// the imageTag and srcset helpers.
+func setUploads(c buffalo.Context, tx *pop.Connection, names ...string) error {
+	uploads, err := models.FindUploads(tx, names...)
+	if err != nil {
+		return err
+	}
+	c.Set("uploads", uploads)
+	return nil
+}
+
+// helperUpload returns the upload of the image name set by setUploads.
+func helperUpload(name string, help plush.HelperContext) (models.Upload, bool) {
+	uploads, _ := help.Value("uploads").(map[string]models.Upload)
+	u, ok := uploads[name]
+	return u, ok
+}
+
+// srcsetHelper lists the variants of an uploaded image with their width,
+// for the srcset attribute. format is "webp", or "" for the format of the
+// upload.
+func srcsetHelper(name, format string, help plush.HelperContext) string {
+	u, ok := helperUpload(name, help)
+	if !ok || !u.HasVariants() {
+		return ""
+	}
+	set := []string{}
+	seen := map[int]bool{}
+	for _, s := range models.ImageSizes {
+		w := u.VariantWidth(s)
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		set = append(set, fmt.Sprintf("%s %dw", imageURL(u.VariantKey(s, format)), w))
+	}
+	return strings.Join(set, ", ")
+}
+
+// imageTagHelper renders an uploaded image at the size named size,
+// offering the browser every variant and the WebP ones first. Images
+// still being processed show a placeholder.
+func imageTagHelper(name, size, alt string, help plush.HelperContext) template.HTML {
+	if name == "" {
+		return ""
+	}
+	s, ok := models.FindImageSize(size)
+	if !ok {
+		s = models.ImageLarge
+	}
+	u, ok := helperUpload(name, help)
+	if ok && !u.IsProcessed() {
+		return template.HTML(fmt.Sprintf(
+			`<div class="image-processing bg-light text-muted text-center py-5" style="max-width: %dpx">The image is being processed.</div>`,
+			s.Width,
+		))
+	}
+	// Files uploaded before variants existed, or that are no images
+	if !ok || !u.HasVariants() {
+		return template.HTML(fmt.Sprintf(
+			`<img src="%s" alt="%s" class="img-fluid" style="max-width: %dpx">`,
+			template.HTMLEscapeString(imageURL(name)), template.HTMLEscapeString(alt), s.Width,
+		))
+	}
+
+	w := u.VariantWidth(s)
+	sizes := fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", w, w)
+	return template.HTML(fmt.Sprintf(
+		`<picture><source type="image/webp" srcset="%s" sizes="%s">`+
+			`<img src="%s" srcset="%s" sizes="%s" alt="%s" width="%d" height="%d" class="img-fluid" loading="lazy"></picture>`,
+		template.HTMLEscapeString(srcsetHelper(name, imaging.WebP, help)), sizes,
+		template.HTMLEscapeString(imageURL(u.VariantKey(s, ""))),
+		template.HTMLEscapeString(srcsetHelper(name, "", help)), sizes,
+		template.HTMLEscapeString(alt), w, u.Height*w/u.Width,
+	))
+}
+
+// formFiles opens the files uploaded in the multiple file input name.
+// The caller closes them with closeFiles.
+func formFiles(c buffalo.Context, name string) ([]binding.File, error) {
+	req := c.Request()
+	if err := req.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		return nil, errors.WithStack(err)
+	}
+	files := []binding.File{}
+	if req.MultipartForm == nil {
+		return files, nil
+	}
+	for _, fh := range req.MultipartForm.File[name] {
+		f, err := fh.Open()
+		if err != nil {
+			closeFiles(files)
+			return nil, errors.WithStack(err)
+		}
+		files = append(files, binding.File{File: f, FileHeader: fh})
+	}
+	return files, nil
+}
+
+// closeFiles closes the files opened by formFiles.
+func closeFiles(files []binding.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// formAttachmentEdits reads the changes made to the gallery by the post
+// form. The fields of every attachment come in the same order, removed
+// attachments are listed by id.
+func formAttachmentEdits(c buffalo.Context) []models.AttachmentEdit {
+	form := c.Request().Form
+	ids := form["AttachmentIDs"]
+	alts := form["AttachmentAlts"]
+	captions := form["AttachmentCaptions"]
+	positions := form["AttachmentPositions"]
+	remove := map[string]bool{}
+	for _, id := range form["AttachmentRemove"] {
+		remove[id] = true
+	}
+
+	edits := []models.AttachmentEdit{}
+	for i, id := range ids {
+		e := models.AttachmentEdit{ID: id, Remove: remove[id]}
+		if i < len(alts) {
+			e.Alt = alts[i]
+		}
+		if i < len(captions) {
+			e.Caption = captions[i]
+		}
+		if i < len(positions) {
+			e.Position, _ = strconv.Atoi(positions[i])
+		}
+		edits = append(edits, e)
+	}
+	return edits
+}
+
+// attachFiles adds the images of the multiple file input "Attachments"
+// to the gallery of the post and asks for their variants.
+func attachFiles(c buffalo.Context, tx *pop.Connection, post *models.Post) (*validate.Errors, error) {
+	files, err := formFiles(c, "Attachments")
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+
+	added, verrs, err := post.Attach(tx, uploadLimits, files)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	for _, a := range added {
+		if err := processUpload(tx, a.UploadKey); err != nil {
+			return verrs, err
+		}
+	}
+	return verrs, nil
+}
+
+// setAttachments makes the gallery of the post and the uploads of its
+// images available to the templates.
+func setAttachments(c buffalo.Context, tx *pop.Connection, post *models.Post) error {
+	attachments, err := post.Attachments(tx)
+	if err != nil {
+		return err
+	}
+	c.Set("attachments", attachments)
+	return setUploads(c, tx, append(attachments.Keys(), post.FileName)...)
+}
+
+// attachmentPlaceholder marks where an embedded attachment goes in the
+// rendered content. It is plain HTML the Markdown sanitizer keeps.
+var attachmentPlaceholder = regexp.MustCompile(`<div class="post-attachment-(\d+)"></div>`)
+
+// postContentHelper renders the Markdown content of a post, with its
+// embedded attachments as figures. The shortcodes become placeholders for
+// the Markdown to be rendered as a whole, the figures replace them after.
+func postContentHelper(content string, help plush.HelperContext) template.HTML {
+	attachments, _ := help.Value("attachments").(models.Attachments)
+	content = models.ExpandShortcodes(content, attachments, func(a models.Attachment) string {
+		return fmt.Sprintf("\n\n<div class=\"post-attachment-%d\"></div>\n\n", a.Number)
+	})
+	out := github_flavored_markdown.Markdown([]byte(content))
+	out = attachmentPlaceholder.ReplaceAllFunc(out, func(m []byte) []byte {
+		n, _ := strconv.Atoi(string(attachmentPlaceholder.FindSubmatch(m)[1]))
+		a, ok := attachments.Number(n)
+		if !ok {
+			return nil
+		}
+		figure := &strings.Builder{}
+		figure.WriteString(`<figure class="figure d-block">`)
+		figure.WriteString(string(imageTagHelper(a.UploadKey, models.ImageLarge.Name, a.Alt, help)))
+		if a.Caption != "" {
+			fmt.Fprintf(figure, `<figcaption class="figure-caption">%s</figcaption>`, template.HTMLEscapeString(a.Caption))
+		}
+		figure.WriteString(`</figure>`)
+		return []byte(figure.String())
+	})
+	return template.HTML(out)
+}
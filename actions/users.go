@@ -2,6 +2,7 @@ package actions
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop"
@@ -32,53 +33,115 @@ func UsersLoginPost(c buffalo.Context) error {
 		return errors.WithStack(err)
 	}
 	tx := c.Value("tx").(*pop.Connection)
-	err := user.Authorize(tx)
+
+	// Slow down password guessing
+	wait, err := loginWait(c, user.Email)
 	if err != nil {
+		return errors.WithStack(err)
+	}
+	if wait != "" {
+		c.Set("user", user)
+		verrs := validate.NewErrors()
+		verrs.Add("Login", wait)
+		c.Set("errors", verrs.Errors)
+		return c.Render(429, r.HTML("users/login"))
+	}
+
+	err = user.Authorize(tx)
+	if err != nil {
+		if err := loginFailed(c, user.Email); err != nil {
+			return errors.WithStack(err)
+		}
 		c.Set("user", user)
 		verrs := validate.NewErrors()
 		verrs.Add("Login", "Invalid email or password.")
 		c.Set("errors", verrs.Errors)
 		return c.Render(422, r.HTML("users/login"))
 	}
-	c.Session().Set("current_user_id", user.ID)
-	c.Flash().Add("success", fmt.Sprintf("Hello %s, Welcome back!", user.Name))
-	return c.Redirect(302, "/")
+	return logIn(c, user)
+}
+
+// logIn starts the session of a user whose password or provider was
+// checked. Users with two-factor authentication are first asked for a
+// code.
+func logIn(c buffalo.Context, user *models.User) error {
+	if user.HasTwoFactor() {
+		c.Session().Set("pending_user_id", user.ID)
+		return c.Redirect(302, "/login/two_factor")
+	}
+	return startSession(c, user)
 }
 func UsersLogout(c buffalo.Context) error {
+	if err := endSession(c); err != nil {
+		return errors.WithStack(err)
+	}
 	c.Session().Clear()
 	c.Flash().Add("success", "Goodbye!")
 	return c.Redirect(302, "/")
 }
 
 // SetCurrentUser attempts to find a user based on the current_user_id
-// in the session. If one is found it is set on the context.
+// in the session. If one is found, and the session was not revoked, it is
+// set on the context.
 func SetCurrentUser(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
 		if uid := c.Session().Get("current_user_id"); uid != nil {
-			u := &models.User{}
 			tx := c.Value("tx").(*pop.Connection)
-			err := tx.Find(u, uid)
+			session, err := models.FindActiveSession(tx, uid, c.Session().Get("session_id"))
 			if err != nil {
+				c.Session().Clear()
+				c.Flash().Add("info", "Your session has ended, please log in again.")
+				return next(c)
+			}
+			u := &models.User{}
+			err = tx.Find(u, uid)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			// Failed requests are rolled back, record the activity outside of them
+			if err := session.Touch(models.DB, time.Now()); err != nil {
 				return errors.WithStack(err)
 			}
 			c.Set("current_user", u)
+			c.Set("current_session", session)
 		}
 		return next(c)
 	}
 }
 
-// AdminRequired requires a user to be logged in and to be an admin before accessing a route.
-func AdminRequired(next buffalo.Handler) buffalo.Handler {
-	return func(c buffalo.Context) error {
-		user, ok := c.Value("current_user").(*models.User)
-		if ok && user.Admin {
-			return next(c)
+// PermissionRequired requires a user to be logged in and to have a role
+// granting perm before accessing a route.
+func PermissionRequired(perm models.Permission) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			user, _ := c.Value("current_user").(*models.User)
+			if user.Can(perm) {
+				return next(c)
+			}
+			c.Flash().Add("danger", "You are not authorized to view that page.")
+			return c.Redirect(302, "/")
 		}
-		c.Flash().Add("danger", "You are not authorized to view that page.")
-		return c.Redirect(302, "/")
 	}
 }
 
+// AdminRequired requires a user to be logged in and to be an admin before accessing a route.
+func AdminRequired(next buffalo.Handler) buffalo.Handler {
+	return PermissionRequired(models.PermUserManage)(next)
+}
+
+// currentUser returns the logged in user, or nil for anonymous visitors.
+func currentUser(c buffalo.Context) *models.User {
+	user, _ := c.Value("current_user").(*models.User)
+	return user
+}
+
+// notAuthorized redirects users trying to do something their role doesn't
+// allow.
+func notAuthorized(c buffalo.Context, url string, args ...interface{}) error {
+	c.Flash().Add("danger", "You are not authorized to view that page.")
+	return c.Redirect(302, url, args...)
+}
+
 // LoginRequired requires a user to be logged in before accessing a route.
 func LoginRequired(next buffalo.Handler) buffalo.Handler {
 	return func(c buffalo.Context) error {
@@ -113,6 +176,7 @@ func List(c buffalo.Context) error {
 
 	// Add the paginator to the context so it can be used in the template.
 	c.Set("pagination", q.Paginator)
+	c.Set("roles", models.Roles)
 
 	return c.Render(200, r.Auto(c, users))
 }
@@ -134,6 +198,12 @@ func Show(c buffalo.Context) error {
 		return c.Error(404, err)
 	}
 
+	locked, err := loginThrottle.Locked(user.Email, time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.Set("locked", locked)
+
 	return c.Render(200, r.Auto(c, user))
 }
 
@@ -174,8 +244,10 @@ func Create(c buffalo.Context) error {
 		return c.Render(422, r.Auto(c, user))
 	}
 
+	sendVerification(c, user)
+
 	// If there are no errors set a success message
-	c.Flash().Add("success", "User was created successfully")
+	c.Flash().Add("success", "User was created successfully, check your inbox to verify your email.")
 
 	// and redirect to the users index page
 	return c.Redirect(302, "/login")
@@ -196,10 +268,63 @@ func Edit(c buffalo.Context) error {
 	if err := tx.Find(user, c.Param("user_id")); err != nil {
 		return c.Error(404, err)
 	}
+	if !canEditUser(c, user) {
+		return notAuthorized(c, "/")
+	}
+
+	if err := setUserEdit(c, tx, user); err != nil {
+		return errors.WithStack(err)
+	}
 
 	return c.Render(200, r.Auto(c, user))
 }
 
+// canEditUser reports whether the current user can change the account of
+// user: their own, or anyone's for admins.
+func canEditUser(c buffalo.Context, user *models.User) bool {
+	current := currentUser(c)
+	return current != nil && (current.ID == user.ID || current.Can(models.PermUserManage))
+}
+
+// setUserEdit makes the account settings of the user available to the
+// edit page.
+func setUserEdit(c buffalo.Context, tx *pop.Connection, user *models.User) error {
+	// Personal access tokens are only shown to their owner
+	tokens := models.AccessTokens{}
+	if currentUser(c).ID == user.ID {
+		if err := tx.Where("user_id = ?", user.ID).Order("created_at desc").All(&tokens); err != nil {
+			return err
+		}
+	}
+	c.Set("tokens", tokens)
+	c.Set("scopes", models.TokenScopes)
+
+	// Two-factor authentication settings
+	left, err := models.CountRecoveryCodes(tx, user)
+	if err != nil {
+		return err
+	}
+	c.Set("recovery_codes_left", left)
+	c.Set("totp_uri", user.TOTPURI(twoFactorIssuer))
+
+	// Linked provider accounts
+	identities, err := user.Identities(tx)
+	if err != nil {
+		return err
+	}
+	c.Set("identities", identities)
+
+	// Devices the user is logged in on
+	sessions, err := user.ActiveSessions(tx)
+	if err != nil {
+		return err
+	}
+	c.Set("sessions", sessions)
+	c.Set("current_session_id", currentSessionID(c))
+	c.Set("notify_choices", models.NotifyChoices)
+	return nil
+}
+
 // Update changes a User in the DB. This function is mapped to
 // the path PUT /users/{user_id}
 func Update(c buffalo.Context) error {
@@ -216,19 +341,43 @@ func Update(c buffalo.Context) error {
 		return c.Error(404, err)
 	}
 
-	// Bind User to the html form elements
-	if err := c.Bind(user); err != nil {
+	if !canEditUser(c, user) {
+		return notAuthorized(c, "/")
+	}
+	email := user.Email
+
+	// Bind only the fields of the form, the role has its own admin path
+	form := struct {
+		Name            string `json:"name" form:"Name"`
+		Email           string `json:"email" form:"Email"`
+		Password        string `json:"password" form:"Password"`
+		PasswordConfirm string `json:"password_confirm" form:"PasswordConfirm"`
+	}{Name: user.Name, Email: user.Email}
+	if err := c.Bind(&form); err != nil {
 		return errors.WithStack(err)
 	}
+	user.Name = form.Name
+	user.Email = form.Email
+	user.Password = form.Password
+	user.PasswordConfirm = form.PasswordConfirm
 
 	verrs, err := user.Update(tx)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if user.Password != "" && !verrs.HasAny() {
+		// A new password signs out the other devices
+		if err := user.RevokeOtherSessions(tx, currentSessionID(c), time.Now()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
 	if verrs.HasAny() {
 		// Make the errors available inside the html template
 		c.Set("errors", verrs.Errors)
+		if err := setUserEdit(c, tx, user); err != nil {
+			return errors.WithStack(err)
+		}
 
 		// Render again the edit.html template that the user can
 		// correct the input.
@@ -237,14 +386,51 @@ func Update(c buffalo.Context) error {
 
 	// If there are no errors set a success message
 	c.Flash().Add("success", "User was updated successfully")
+	if user.Email != email && !user.IsVerified() {
+		sendVerification(c, user)
+		c.Flash().Add("info", "Check your inbox to verify your new email address.")
+	}
 
 	// and redirect to the users index page
-	if user.Admin {
+	if user.IsAdmin() {
 		return c.Render(200, r.Auto(c, user))
 	}
 	return c.Redirect(302, "/users/%s/edit", user.ID)
 }
 
+// UsersRoleUpdate changes the role of a User. This function is mapped
+// to the path PUT /users/{user_id}/role
+func UsersRoleUpdate(c buffalo.Context) error {
+	// Get the DB connection from the context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user := &models.User{}
+	if err := tx.Find(user, c.Param("user_id")); err != nil {
+		return c.Error(404, err)
+	}
+
+	// Admins can't demote themselves and lock everyone out
+	if user.ID == currentUser(c).ID {
+		c.Flash().Add("danger", "You can't change your own role.")
+		return c.Redirect(302, "/users")
+	}
+
+	verrs, err := user.SetRole(tx, c.Request().FormValue("Role"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		c.Flash().Add("danger", "That role does not exist.")
+		return c.Redirect(302, "/users")
+	}
+
+	c.Flash().Add("success", fmt.Sprintf("%s is now %s.", user.Username, user.Role))
+	return c.Redirect(302, "/users")
+}
+
 // Destroy deletes a User from the DB. This function is mapped
 // to the path DELETE /users/{user_id}
 func Destroy(c buffalo.Context) error {
@@ -1,5 +1,7 @@
 package actions
 
+import "github.com/sampalm/buffalo/blogapp/models"
+
 func (as *ActionSuite) Test_UsersResource_List() {
 	as.Fail("Not Implemented!")
 }
@@ -27,3 +29,16 @@ func (as *ActionSuite) Test_UsersResource_Update() {
 func (as *ActionSuite) Test_UsersResource_Destroy() {
 	as.Fail("Not Implemented!")
 }
+
+func (as *ActionSuite) Test_Users_Update_KeepsRole() {
+	user := as.createUser("climber", models.RoleCommenter)
+	res := as.HTML("/login").Post(map[string]string{"Email": user.Email, "Password": "password"})
+	as.Equal(302, res.Code)
+
+	res = as.JSON("/users/%s", user.ID).Put(map[string]string{"name": "Climber", "role": models.RoleAdmin})
+	as.NotEqual(500, res.Code)
+
+	as.NoError(as.DB.Reload(user))
+	as.Equal("Climber", user.Name)
+	as.Equal(models.RoleCommenter, user.Role)
+}
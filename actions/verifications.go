@@ -0,0 +1,98 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// sendVerification emails a link verifying the current address of the
+// user. Failures are only logged so they don't lose the saved account.
+func sendVerification(c buffalo.Context, user *models.User) {
+	if user.Email == "" {
+		return
+	}
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		c.Logger().Errorf("verification email to %s: transaction not found", user.Email)
+		return
+	}
+	if err := queueMail(tx, "mail_email_verification", user, ""); err != nil {
+		c.Logger().Errorf("verification email to %s: %v", user.Email, err)
+	}
+}
+
+// UsersVerify verifies the email of the user from the link sent to them.
+// This function is mapped to the path GET /users/verify/{token}
+func UsersVerify(c buffalo.Context) error {
+	// Get the DB connection from the context
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user, err := models.FindUserByVerificationToken(tx, c.Param("token"), time.Now())
+	if err != nil {
+		c.Flash().Add("danger", "This verification link is invalid or has expired.")
+		return c.Redirect(302, "/")
+	}
+	if err := user.VerifyEmail(tx, time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", "Your email address is verified, thank you!")
+	return c.Redirect(302, "/")
+}
+
+// UsersVerificationResend sends the verification link again. Users can
+// ask for their own link, admins for anyone. This function is mapped to
+// the path POST /users/{user_id}/verification
+func UsersVerificationResend(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user := &models.User{}
+	if err := tx.Find(user, c.Param("user_id")); err != nil {
+		return c.Error(404, err)
+	}
+	current := currentUser(c)
+	if user.ID != current.ID && !current.Can(models.PermUserManage) {
+		return notAuthorized(c, "/")
+	}
+	if user.IsVerified() {
+		c.Flash().Add("info", "This email address is already verified.")
+	} else {
+		sendVerification(c, user)
+		c.Flash().Add("success", "A verification link was sent to "+user.Email+".")
+	}
+
+	if user.ID == current.ID {
+		return c.Redirect(302, "/users/%s/edit", user.ID)
+	}
+	return c.Redirect(302, "/users")
+}
+
+// UsersVerifyUpdate lets admins verify the email of a user by hand. This
+// function is mapped to the path PUT /users/{user_id}/verify
+func UsersVerifyUpdate(c buffalo.Context) error {
+	tx, ok := c.Value("tx").(*pop.Connection)
+	if !ok {
+		return errors.WithStack(errors.New("no transaction found"))
+	}
+
+	user := &models.User{}
+	if err := tx.Find(user, c.Param("user_id")); err != nil {
+		return c.Error(404, err)
+	}
+	if err := user.VerifyEmail(tx, time.Now()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Flash().Add("success", user.Username+" is now verified.")
+	return c.Redirect(302, "/users")
+}
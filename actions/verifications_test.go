@@ -0,0 +1,43 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/sampalm/buffalo/blogapp/mailers"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (as *ActionSuite) Test_Users_VerifyEmail() {
+	rec := &mailRecorder{}
+	sender := mailers.Sender
+	mailers.Sender = rec
+	defer func() { mailers.Sender = sender }()
+
+	res := as.HTML("/users").Post(map[string]string{
+		"Name":            "Newcomer",
+		"Username":        "newcomer",
+		"Email":           "newcomer@example.com",
+		"Password":        "password",
+		"PasswordConfirm": "password",
+	})
+	as.Equal(302, res.Code)
+	as.Len(rec.messages, 1)
+
+	user := &models.User{}
+	as.NoError(as.DB.Where("email = ?", "newcomer@example.com").First(user))
+	as.False(user.IsVerified())
+	as.False(user.CanComment())
+
+	body := rec.messages[0].Bodies[0].Content
+	i := strings.Index(body, "/users/verify/")
+	as.True(i > 0)
+	res = as.HTML(strings.Fields(body[i:])[0]).Get()
+	as.Equal(302, res.Code)
+
+	as.NoError(as.DB.Find(user, user.ID))
+	as.True(user.IsVerified())
+	as.True(user.CanComment())
+
+	res = as.HTML("/users/verify/forged").Get()
+	as.Equal(302, res.Code)
+}
@@ -0,0 +1,27 @@
+package grifts
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/markbates/grift/grift"
+	"github.com/sampalm/buffalo/blogapp/actions"
+)
+
+var _ = grift.Namespace("jobs", func() {
+
+	grift.Desc("work", "Runs the background jobs until interrupted, run the web process with JOBS_WORKER_OFF=true")
+	grift.Add("work", func(c *grift.Context) error {
+		w := actions.App().Worker
+		if err := w.Start(context.Background()); err != nil {
+			return err
+		}
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		return w.Stop()
+	})
+
+})
@@ -0,0 +1,25 @@
+package grifts
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/markbates/grift/grift"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+var _ = grift.Namespace("posts", func() {
+
+	grift.Desc("publish", "Publishes scheduled posts whose time has come")
+	grift.Add("publish", func(c *grift.Context) error {
+		return models.PublishDuePosts(models.DB, time.Now())
+	})
+
+	grift.Desc("slugs", "Generates title based slugs for posts still addressed by id")
+	grift.Add("slugs", func(c *grift.Context) error {
+		return models.DB.Transaction(func(tx *pop.Connection) error {
+			return models.RegenerateSlugs(tx)
+		})
+	})
+
+})
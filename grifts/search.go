@@ -0,0 +1,18 @@
+package grifts
+
+import (
+	"github.com/gobuffalo/pop"
+	"github.com/markbates/grift/grift"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+var _ = grift.Namespace("search", func() {
+
+	grift.Desc("reindex", "Rebuilds the full-text search index of posts and comments")
+	grift.Add("reindex", func(c *grift.Context) error {
+		return models.DB.Transaction(func(tx *pop.Connection) error {
+			return models.RebuildSearchIndex(tx)
+		})
+	})
+
+})
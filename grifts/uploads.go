@@ -0,0 +1,71 @@
+package grifts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/markbates/grift/grift"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"github.com/sampalm/buffalo/blogapp/storage"
+)
+
+var _ = grift.Namespace("uploads", func() {
+
+	grift.Desc("rehash", "Renames the uploaded files by the hash of their content and counts the posts using them")
+	grift.Add("rehash", func(c *grift.Context) error {
+		var moved []string
+		err := models.DB.Transaction(func(tx *pop.Connection) error {
+			var err error
+			moved, err = models.RehashUploads(tx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// The old names are only removed once the posts use the new ones
+		for _, name := range moved {
+			if err := storage.Default.Delete(name); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%d files renamed\n", len(moved))
+		return nil
+	})
+
+	grift.Desc("process", "Makes the resized variants of the images uploaded before they existed")
+	grift.Add("process", func(c *grift.Context) error {
+		pending := models.Uploads{}
+		if err := models.DB.Where("processed_at is null").All(&pending); err != nil {
+			return err
+		}
+		for _, u := range pending {
+			if err := models.ProcessUpload(models.DB, u.Key, time.Now()); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%d images processed\n", len(pending))
+		return nil
+	})
+
+	grift.Desc("collect", "Removes the uploaded files no post uses anymore")
+	grift.Add("collect", func(c *grift.Context) error {
+		n, err := models.CollectUploads(models.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files removed\n", n)
+		return nil
+	})
+
+	grift.Desc("sweep", "Removes the stored files no upload or post names, older than an hour")
+	grift.Add("sweep", func(c *grift.Context) error {
+		n, err := models.SweepUploads(models.DB, time.Now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d files removed\n", n)
+		return nil
+	})
+
+})
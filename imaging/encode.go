@@ -0,0 +1,34 @@
+package imaging
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/pkg/errors"
+)
+
+// Image formats written by Encode.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	WebP = "webp"
+)
+
+// Quality of the lossy formats.
+const Quality = 82
+
+// Encode writes the image in format. Encoding never copies metadata.
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case JPEG:
+		return errors.WithStack(jpeg.Encode(w, img, &jpeg.Options{Quality: Quality}))
+	case PNG:
+		return errors.WithStack(png.Encode(w, img))
+	case WebP:
+		return errors.WithStack(webp.Encode(w, img, &webp.Options{Quality: Quality}))
+	}
+	return errors.Errorf("unknown image format %q", format)
+}
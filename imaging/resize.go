@@ -0,0 +1,81 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Orient turns an image the right way up, following its EXIF
+// orientation.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 to 8 are rotated by a quarter turn
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// Upright turns the content of an image the right way up, following the
+// EXIF orientation returned by Strip. Content that is no image is
+// returned as is.
+func Upright(content []byte, orientation int) ([]byte, error) {
+	if orientation <= 1 || orientation > 8 {
+		return content, nil
+	}
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return content, nil
+	}
+	buf := &bytes.Buffer{}
+	if err := Encode(buf, Orient(img, orientation), format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Resize scales an image down to width, keeping its proportions. Images
+// already narrower are returned as they are.
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width <= 0 || b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,63 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func Test_Orient(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, red)
+
+	// Rotated a quarter turn clockwise, the top left corner goes top right
+	o := Orient(img, 6)
+	if o.Bounds().Dx() != 2 || o.Bounds().Dy() != 3 {
+		t.Fatalf("expected a 2x3 image, got %v", o.Bounds())
+	}
+	if o.At(1, 0) != red {
+		t.Fatalf("expected the red pixel top right, got %v", o.At(1, 0))
+	}
+	if Orient(img, 1) != image.Image(img) {
+		t.Fatal("expected upright images as they are")
+	}
+}
+
+func Test_Upright(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := Upright(buf.Bytes(), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != PNG || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 3 {
+		t.Fatalf("expected a 2x3 png, got a %v %s", img.Bounds(), format)
+	}
+
+	if content, _ := Upright(buf.Bytes(), 1); !bytes.Equal(content, buf.Bytes()) {
+		t.Fatal("expected upright images as they are")
+	}
+	if content, _ := Upright([]byte("text"), 6); string(content) != "text" {
+		t.Fatal("expected other content as it is")
+	}
+}
+
+func Test_Resize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	if b := Resize(img, 100).Bounds(); b.Dx() != 100 || b.Dy() != 75 {
+		t.Fatalf("expected 100x75, got %v", b)
+	}
+	if Resize(img, 800) != image.Image(img) {
+		t.Fatal("expected narrower images as they are")
+	}
+}
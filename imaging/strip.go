@@ -0,0 +1,139 @@
+// Package imaging prepares uploaded images for the web: it removes their
+// metadata, turns them the right way up and resizes them.
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// orientationTag is the EXIF tag telling how the camera was held.
+const orientationTag = 0x0112
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadata lists the PNG chunks removed by Strip.
+var pngMetadata = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// Strip removes the EXIF, XMP and text metadata, GPS position included,
+// of a JPEG or PNG image. The pixels are left untouched. It returns the
+// EXIF orientation, 1 when there is none, so the image can still be
+// turned the right way up. Other content is returned as is.
+func Strip(content []byte) ([]byte, int) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xff, 0xd8}):
+		return stripJPEG(content)
+	case bytes.HasPrefix(content, pngSignature):
+		return stripPNG(content)
+	}
+	return content, 1
+}
+
+// stripJPEG drops the APP1 (EXIF, XMP), APP13 (IPTC) and comment
+// segments of a JPEG.
+func stripJPEG(content []byte) ([]byte, int) {
+	orientation := 1
+	out := bytes.NewBuffer(make([]byte, 0, len(content)))
+	out.Write(content[:2])
+	i := 2
+	for i+4 <= len(content) {
+		if content[i] != 0xff {
+			break
+		}
+		marker := content[i+1]
+		// Standalone markers have no length
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			out.Write(content[i : i+2])
+			i += 2
+			continue
+		}
+		// The compressed data starts, there is no metadata after it
+		if marker == 0xda {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(content[i+2:]))
+		if end > len(content) {
+			break
+		}
+		switch marker {
+		case 0xe1:
+			if o := exifOrientation(bytes.TrimPrefix(content[i+4:end], []byte("Exif\x00\x00"))); o != 0 {
+				orientation = o
+			}
+		case 0xed, 0xfe:
+		default:
+			out.Write(content[i:end])
+		}
+		i = end
+	}
+	out.Write(content[i:])
+	return out.Bytes(), orientation
+}
+
+// stripPNG drops the chunks of pngMetadata.
+func stripPNG(content []byte) ([]byte, int) {
+	orientation := 1
+	out := bytes.NewBuffer(make([]byte, 0, len(content)))
+	out.Write(pngSignature)
+	i := len(pngSignature)
+	for i+12 <= len(content) {
+		end := i + 12 + int(binary.BigEndian.Uint32(content[i:]))
+		if end > len(content) {
+			break
+		}
+		kind := string(content[i+4 : i+8])
+		if kind == "eXIf" {
+			if o := exifOrientation(content[i+8 : end-4]); o != 0 {
+				orientation = o
+			}
+		}
+		if !pngMetadata[kind] {
+			out.Write(content[i:end])
+		}
+		i = end
+	}
+	out.Write(content[i:])
+	return out.Bytes(), orientation
+}
+
+// exifOrientation reads the orientation of the first directory of EXIF
+// data, 0 when it has none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
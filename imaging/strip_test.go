@@ -0,0 +1,67 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifSegment builds an APP1 segment with an orientation and a made up
+// GPS directory pointer.
+func exifSegment(orientation uint16) []byte {
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	binary.Write(tiff, binary.BigEndian, uint16(2))
+	// Orientation, a SHORT
+	binary.Write(tiff, binary.BigEndian, []uint16{orientationTag, 3})
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, []uint16{orientation, 0})
+	// GPS directory, a LONG
+	binary.Write(tiff, binary.BigEndian, []uint16{0x8825, 4})
+	binary.Write(tiff, binary.BigEndian, []uint32{1, 38})
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPS 48.8584 2.2945")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func Test_Strip_JPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	plain := &bytes.Buffer{}
+	if err := jpeg.Encode(plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	tagged := append([]byte{0xff, 0xd8}, exifSegment(6)...)
+	tagged = append(tagged, plain.Bytes()[2:]...)
+
+	stripped, orientation := Strip(tagged)
+	if orientation != 6 {
+		t.Fatalf("expected orientation 6, got %d", orientation)
+	}
+	if bytes.Contains(stripped, []byte("GPS")) || bytes.Contains(stripped, []byte("Exif")) {
+		t.Fatal("expected the EXIF data to be removed")
+	}
+	if !bytes.Equal(stripped, plain.Bytes()) {
+		t.Fatal("expected the rest of the image to be untouched")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Fatalf("expected a valid image, got %v", err)
+	}
+}
+
+func Test_Strip_Unknown(t *testing.T) {
+	content := []byte("GIF89a")
+	stripped, orientation := Strip(content)
+	if !bytes.Equal(stripped, content) || orientation != 1 {
+		t.Fatalf("expected unknown content as is, got %q %d", stripped, orientation)
+	}
+}
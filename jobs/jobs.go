@@ -0,0 +1,257 @@
+// Package jobs runs the slow work of the application in the background,
+// from a queue kept in PostgreSQL. It implements the worker interface of
+// Buffalo, so handlers are registered and jobs performed like with any
+// other Buffalo worker.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo/worker"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// Queue is a worker that can also queue jobs within a transaction, so
+// they only run once the work they depend on is committed.
+type Queue interface {
+	worker.Worker
+	PerformTx(tx *pop.Connection, job worker.Job) error
+}
+
+// Options configures a Worker.
+type Options struct {
+	// Concurrency is the number of jobs run at the same time.
+	Concurrency int
+	// Poll is the wait between looks at an empty queue.
+	Poll time.Duration
+	// Timeout is how long a job can run before another worker takes it
+	// over.
+	Timeout time.Duration
+	// Logger reports the failed jobs, the standard logger when nil.
+	Logger Logger
+}
+
+// Logger is where failures are reported, like the logger of a Buffalo
+// application.
+type Logger interface {
+	Errorf(format string, args ...interface{})
+}
+
+// stdLogger reports to the standard logger.
+type stdLogger struct{}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	log.Printf("ERROR "+format, args...)
+}
+
+// Worker runs the jobs queued in the jobs table of DB. Several workers,
+// in several processes, can share the same queue.
+type Worker struct {
+	DB       *pop.Connection
+	Options  Options
+	handlers map[string]worker.Handler
+	mu       sync.RWMutex
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New returns a worker of the queue of db.
+func New(db *pop.Connection, opts Options) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 2
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	if opts.Logger == nil {
+		opts.Logger = stdLogger{}
+	}
+	return &Worker{
+		DB:       db,
+		Options:  opts,
+		handlers: map[string]worker.Handler{},
+	}
+}
+
+// Register makes handler run the jobs named name.
+func (w *Worker) Register(name string, handler worker.Handler) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.handlers[name]; ok {
+		return errors.Errorf("job handler %q is already registered", name)
+	}
+	w.handlers[name] = handler
+	return nil
+}
+
+// Start runs the jobs of the queue until ctx is done or Stop is called.
+func (w *Worker) Start(ctx context.Context) error {
+	ctx, w.cancel = context.WithCancel(ctx)
+	for i := 0; i < w.Options.Concurrency; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	return nil
+}
+
+// Stop waits for the running jobs to finish.
+func (w *Worker) Stop() error {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+	return nil
+}
+
+// Perform queues the job to run now.
+func (w *Worker) Perform(job worker.Job) error {
+	return w.enqueue(w.DB, job, time.Now())
+}
+
+// PerformTx queues the job to run once tx is committed.
+func (w *Worker) PerformTx(tx *pop.Connection, job worker.Job) error {
+	return w.enqueue(tx, job, time.Now())
+}
+
+// PerformAt queues the job to run at t.
+func (w *Worker) PerformAt(job worker.Job, t time.Time) error {
+	return w.enqueue(w.DB, job, t)
+}
+
+// PerformIn queues the job to run after d.
+func (w *Worker) PerformIn(job worker.Job, d time.Duration) error {
+	return w.enqueue(w.DB, job, time.Now().Add(d))
+}
+
+func (w *Worker) enqueue(tx *pop.Connection, job worker.Job, at time.Time) error {
+	_, err := models.EnqueueJob(tx, job.Queue, job.Handler, job.Args, at)
+	return err
+}
+
+// loop claims and runs jobs until ctx is done.
+func (w *Worker) loop(ctx context.Context) {
+	for {
+		ran, err := w.Work(time.Now())
+		if err != nil {
+			w.Options.Logger.Errorf("jobs: %v", err)
+		}
+		if ran && err == nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.Options.Poll):
+		}
+	}
+}
+
+// Work runs the next job due at now, if any, and reports whether there
+// was one. A failed job is queued again or marked dead.
+func (w *Worker) Work(now time.Time) (bool, error) {
+	j, err := models.ClaimJob(w.DB, now, now.Add(-w.Options.Timeout))
+	if err != nil || j == nil {
+		return false, err
+	}
+
+	if err := w.run(j); err != nil {
+		w.Options.Logger.Errorf("jobs: %s attempt %d failed: %v", j.Handler, j.Attempts, err)
+		return true, j.Fail(w.DB, err, time.Now())
+	}
+	return true, j.Complete(w.DB)
+}
+
+// run calls the handler of the job, turning panics into errors.
+func (w *Worker) run(j *models.Job) (err error) {
+	w.mu.RLock()
+	h, ok := w.handlers[j.Handler]
+	w.mu.RUnlock()
+	if !ok {
+		return errors.Errorf("no handler registered for %q", j.Handler)
+	}
+	args, err := j.Decode()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(worker.Args(args))
+}
+
+// Inline runs every job right away, in the goroutine performing it. It
+// keeps tests free of background work.
+type Inline struct {
+	handlers map[string]worker.Handler
+}
+
+// NewInline returns a worker running jobs as they are performed.
+func NewInline() *Inline {
+	return &Inline{handlers: map[string]worker.Handler{}}
+}
+
+// Register makes handler run the jobs named name.
+func (w *Inline) Register(name string, handler worker.Handler) error {
+	if _, ok := w.handlers[name]; ok {
+		return errors.Errorf("job handler %q is already registered", name)
+	}
+	w.handlers[name] = handler
+	return nil
+}
+
+// Start does nothing, jobs run when performed.
+func (w *Inline) Start(ctx context.Context) error { return nil }
+
+// Stop does nothing.
+func (w *Inline) Stop() error { return nil }
+
+// Perform runs the job. Its arguments go through JSON like with the
+// queue.
+func (w *Inline) Perform(job worker.Job) error {
+	h, ok := w.handlers[job.Handler]
+	if !ok {
+		return errors.Errorf("no handler registered for %q", job.Handler)
+	}
+	b, err := json.Marshal(job.Args)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	args := worker.Args{}
+	if err := json.Unmarshal(b, &args); err != nil {
+		return errors.WithStack(err)
+	}
+	return h(args)
+}
+
+// PerformTx runs the job.
+func (w *Inline) PerformTx(tx *pop.Connection, job worker.Job) error {
+	return w.Perform(job)
+}
+
+// PerformAt runs the job.
+func (w *Inline) PerformAt(job worker.Job, t time.Time) error {
+	return w.Perform(job)
+}
+
+// PerformIn runs the job.
+func (w *Inline) PerformIn(job worker.Job, d time.Duration) error {
+	return w.Perform(job)
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/gobuffalo/buffalo/worker"
+)
+
+func Test_Inline(t *testing.T) {
+	w := NewInline()
+	var got worker.Args
+	if err := w.Register("record", func(args worker.Args) error {
+		got = args
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Register("record", func(worker.Args) error { return nil }); err == nil {
+		t.Fatal("expected registering a handler twice to fail")
+	}
+
+	if err := w.PerformIn(worker.Job{Handler: "record", Args: worker.Args{"count": 3}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Arguments go through JSON, like with the queue
+	if got["count"] != float64(3) {
+		t.Fatalf("expected the decoded arguments, got %v", got)
+	}
+	if err := w.Perform(worker.Job{Handler: "missing"}); err == nil {
+		t.Fatal("expected an unknown handler to fail")
+	}
+}
@@ -0,0 +1,19 @@
+package mailers
+
+import (
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// SendAccountLocked warns the user that their account was locked out
+// after failed logins, with a link to unlock it.
+func SendAccountLocked(user *models.User, link string) error {
+	m := mail.NewMessage()
+	m.Subject = "Your account was locked"
+	m.To = []string{user.Email}
+	return send(&m, "account_locked", render.Data{
+		"user": user,
+		"link": link,
+	})
+}
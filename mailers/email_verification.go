@@ -0,0 +1,19 @@
+package mailers
+
+import (
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// SendEmailVerification sends the link verifying the email of the user.
+func SendEmailVerification(user *models.User, link string) error {
+	m := mail.NewMessage()
+	m.Subject = "Verify your email address"
+	m.To = []string{user.Email}
+	return send(&m, "email_verification", render.Data{
+		"user":    user,
+		"link":    link,
+		"expires": models.EmailVerificationTTL.String(),
+	})
+}
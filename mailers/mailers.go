@@ -0,0 +1,121 @@
+package mailers
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/packr"
+	"github.com/pkg/errors"
+)
+
+// Sender delivers the emails of the application. It is chosen from the
+// MAILER environment variable: "smtp", "file" or "log". Tests can replace
+// it to inspect the sent messages.
+var Sender mail.Sender
+
+// From is the sender address of every email.
+var From = envy.Get("MAIL_FROM", "no-reply@blogapp.local")
+
+var r *render.Engine
+
+func init() {
+	var err error
+	Sender, err = newSender(envy.Get("MAILER", defaultMailer()))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r = render.New(render.Options{
+		HTMLLayout:   "layout.html",
+		TemplatesBox: packr.NewBox("../templates/mail"),
+		Helpers:      render.Helpers{},
+	})
+}
+
+// defaultMailer only sends real emails in production.
+func defaultMailer() string {
+	switch envy.Get("GO_ENV", "development") {
+	case "production":
+		return "smtp"
+	case "test":
+		return "log"
+	}
+	return "file"
+}
+
+// newSender builds the sender named name.
+func newSender(name string) (mail.Sender, error) {
+	switch name {
+	case "smtp":
+		// Pulling config from the env.
+		port := envy.Get("SMTP_PORT", "1025")
+		host := envy.Get("SMTP_HOST", "localhost")
+		user := envy.Get("SMTP_USER", "")
+		password := envy.Get("SMTP_PASSWORD", "")
+		return mail.NewSMTPSender(host, port, user, password)
+	case "file":
+		return FileSender{Dir: envy.Get("MAIL_DIR", filepath.Join("tmp", "mail"))}, nil
+	case "log":
+		return LogSender{}, nil
+	}
+	return nil, errors.Errorf("unknown mailer %q", name)
+}
+
+// FileSender writes every email to a file of Dir, to read them while
+// developing without a mail server.
+type FileSender struct {
+	Dir string
+}
+
+// Send writes the message to a new .eml file.
+func (s FileSender) Send(m mail.Message) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	err := ioutil.WriteFile(filepath.Join(s.Dir, name), format(m), 0644)
+	return errors.WithStack(err)
+}
+
+// LogSender prints every email to the log.
+type LogSender struct{}
+
+// Send logs the message.
+func (LogSender) Send(m mail.Message) error {
+	log.Printf("mail sent:\n%s", format(m))
+	return nil
+}
+
+// format renders the headers and bodies of a message as text.
+func format(m mail.Message) []byte {
+	bb := &bytes.Buffer{}
+	fmt.Fprintf(bb, "From: %s\n", m.From)
+	fmt.Fprintf(bb, "To: %s\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(bb, "Subject: %s\n", m.Subject)
+	for _, body := range m.Bodies {
+		fmt.Fprintf(bb, "\n--- %s\n%s\n", body.ContentType, body.Content)
+	}
+	return bb.Bytes()
+}
+
+// send renders the text and HTML bodies of the template name and sends
+// the message.
+func send(m *mail.Message, name string, data render.Data) error {
+	m.From = From
+	if err := m.AddBody(r.Plain(name+".txt"), data); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := m.AddBody(r.HTML(name+".html"), data); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(Sender.Send(*m))
+}
@@ -0,0 +1,43 @@
+package mailers
+
+import (
+	"fmt"
+
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// SendCommentNotification tells the user about a comment on their post
+// or a reply to their comment. Links to the posts start with host.
+func SendCommentNotification(user *models.User, item models.NotificationItem, host, unsubscribe string) error {
+	m := mail.NewMessage()
+	if item.Kind == models.NotificationReply {
+		m.Subject = fmt.Sprintf("%s replied to your comment", item.Commenter.Username)
+	} else {
+		m.Subject = fmt.Sprintf("%s commented on %s", item.Commenter.Username, item.Post.Title)
+	}
+	m.To = []string{user.Email}
+	m.SetHeader("List-Unsubscribe", "<"+unsubscribe+">")
+	return send(&m, "comment_notification", render.Data{
+		"user":        user,
+		"item":        item,
+		"host":        host,
+		"unsubscribe": unsubscribe,
+	})
+}
+
+// SendDigest sends the user the comments of the day they chose to get
+// in a digest.
+func SendDigest(user *models.User, items []models.NotificationItem, host, unsubscribe string) error {
+	m := mail.NewMessage()
+	m.Subject = fmt.Sprintf("%d new comments", len(items))
+	m.To = []string{user.Email}
+	m.SetHeader("List-Unsubscribe", "<"+unsubscribe+">")
+	return send(&m, "digest", render.Data{
+		"user":        user,
+		"items":       items,
+		"host":        host,
+		"unsubscribe": unsubscribe,
+	})
+}
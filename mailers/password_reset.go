@@ -0,0 +1,19 @@
+package mailers
+
+import (
+	"github.com/gobuffalo/buffalo/mail"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// SendPasswordReset sends the link to choose a new password to the user.
+func SendPasswordReset(user *models.User, link string) error {
+	m := mail.NewMessage()
+	m.Subject = "Reset your password"
+	m.To = []string{user.Email}
+	return send(&m, "password_reset", render.Data{
+		"user":    user,
+		"link":    link,
+		"expires": models.PasswordResetTTL.String(),
+	})
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// Token scopes. Each scope includes the ones before it.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// TokenScopes lists every scope a token can carry.
+var TokenScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// accessTokenPrefix makes personal tokens easy to recognize.
+const accessTokenPrefix = "blog_"
+
+// touchInterval avoids writing the last use of a token on every request.
+const touchInterval = time.Minute
+
+// AccessToken is a personal token used to authenticate against the API.
+// Only a hash of the token is stored.
+type AccessToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	Scopes     string     `json:"scopes" db:"scopes"`
+	ExpiresAt  nulls.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt nulls.Time `json:"last_used_at" db:"last_used_at"`
+	Token      string     `json:"-" db:"-"`
+}
+
+type AccessTokens []AccessToken
+
+// IsAccessToken reports whether s looks like a personal access token.
+func IsAccessToken(s string) bool {
+	return strings.HasPrefix(s, accessTokenPrefix)
+}
+
+// Generate creates a new random token for the user and saves its hash.
+// The clear token is only available in Token until the struct is dropped.
+func (t *AccessToken) Generate(tx *pop.Connection, scopes []string, expiresIn time.Duration) (*validate.Errors, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	t.Token = accessTokenPrefix + hex.EncodeToString(b)
+	t.TokenHash = hashToken(t.Token)
+	t.Scopes = strings.Join(scopes, ",")
+	if expiresIn > 0 {
+		t.ExpiresAt = nulls.NewTime(time.Now().Add(expiresIn))
+	}
+	return tx.ValidateAndCreate(t)
+}
+
+// FindAccessToken finds the unexpired token matching token.
+func FindAccessToken(tx *pop.Connection, token string) (*AccessToken, error) {
+	t := &AccessToken{}
+	if err := tx.Where("token_hash = ?", hashToken(token)).First(t); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if t.IsExpired(time.Now()) {
+		return nil, errors.New("access token expired")
+	}
+	return t, nil
+}
+
+// ScopeList returns the scopes of the token.
+func (t AccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the token grants scope. Broader scopes grant
+// the narrower ones, so a write token can read.
+func (t AccessToken) HasScope(scope string) bool {
+	want := scopeLevel(scope)
+	for _, s := range t.ScopeList() {
+		if scopeLevel(s) >= want {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token is expired at now.
+func (t AccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt.Valid && !t.ExpiresAt.Time.After(now)
+}
+
+// Touch records the use of the token.
+func (t *AccessToken) Touch(tx *pop.Connection, now time.Time) error {
+	if t.LastUsedAt.Valid && now.Sub(t.LastUsedAt.Time) < touchInterval {
+		return nil
+	}
+	t.LastUsedAt = nulls.NewTime(now)
+	err := tx.RawQuery("UPDATE access_tokens SET last_used_at = ? WHERE id = ?", now, t.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (t *AccessToken) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	verrs := validate.Validate(
+		&validators.StringIsPresent{Field: t.Name, Name: "Name"},
+	)
+	scopes := t.ScopeList()
+	if len(scopes) == 0 {
+		verrs.Add("Scopes", "Select at least one scope.")
+	}
+	for _, s := range scopes {
+		if scopeLevel(s) == 0 {
+			verrs.Add("Scopes", fmt.Sprintf("%s is not a valid scope.", s))
+		}
+	}
+	return verrs, nil
+}
+
+// scopeLevel orders the scopes, unknown scopes are 0.
+func scopeLevel(scope string) int {
+	for i, s := range TokenScopes {
+		if s == scope {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// hashToken hashes a token for storage.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_AccessToken_Generate() {
+	token := &models.AccessToken{UserID: ms.uuid(), Name: "script"}
+	verrs, err := token.Generate(ms.DB, []string{models.ScopeWrite}, time.Hour)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.True(models.IsAccessToken(token.Token))
+	ms.NotEqual(token.Token, token.TokenHash)
+
+	found, err := models.FindAccessToken(ms.DB, token.Token)
+	ms.NoError(err)
+	ms.Equal(token.ID, found.ID)
+	ms.True(found.HasScope(models.ScopeRead))
+	ms.True(found.HasScope(models.ScopeWrite))
+	ms.False(found.HasScope(models.ScopeAdmin))
+
+	_, err = models.FindAccessToken(ms.DB, token.Token+"x")
+	ms.Error(err)
+}
+
+func (ms *ModelSuite) Test_AccessToken_Validate() {
+	token := &models.AccessToken{UserID: ms.uuid(), Name: "bad"}
+	verrs, err := token.Generate(ms.DB, []string{"everything"}, 0)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// AkismetChecker asks an Akismet compatible service whether comments are
+// spam.
+type AkismetChecker struct {
+	// URL is the root of the service, https://{key}.rest.akismet.com for
+	// Akismet itself.
+	URL string
+	Key string
+	// Blog is the url of the site.
+	Blog   string
+	Client *http.Client
+}
+
+// NewAkismetChecker returns a checker for the Akismet service, or the
+// service at rootURL when it is not empty.
+func NewAkismetChecker(key, blog, rootURL string) *AkismetChecker {
+	if rootURL == "" {
+		rootURL = "https://" + key + ".rest.akismet.com"
+	}
+	return &AkismetChecker{
+		URL:    strings.TrimRight(rootURL, "/"),
+		Key:    key,
+		Blog:   blog,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Check calls the comment-check method of the service.
+func (a *AkismetChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	form := url.Values{
+		"api_key":         {a.Key},
+		"blog":            {a.Blog},
+		"user_ip":         {in.IP},
+		"user_agent":      {in.UserAgent},
+		"referrer":        {in.Referrer},
+		"permalink":       {in.Permalink},
+		"comment_type":    {"comment"},
+		"comment_content": {in.Comment.Content},
+	}
+	if in.Author != nil {
+		form.Set("comment_author", in.Author.Username)
+		form.Set("comment_author_email", in.Author.Email)
+	}
+
+	res, err := a.Client.PostForm(a.URL+"/1.1/comment-check", form)
+	if err != nil {
+		return SpamVerdict{}, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return SpamVerdict{}, errors.WithStack(err)
+	}
+
+	switch strings.TrimSpace(string(body)) {
+	case "true":
+		return SpamVerdict{Score: SpamThreshold, Reason: "flagged by Akismet"}, nil
+	case "false":
+		return SpamVerdict{}, nil
+	}
+	return SpamVerdict{}, errors.Errorf("akismet: unexpected answer %q (%s)", body, res.Header.Get("X-akismet-debug-help"))
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo/binding"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/pkg/errors"
+)
+
+// Attachment is an image of a post gallery. Number never changes and is
+// how the content embeds the image, with [[attachment:Number]]. The cover
+// attachment is the one whose upload is the image of the post.
+type Attachment struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PostID    uuid.UUID `json:"post_id" db:"post_id"`
+	UploadKey string    `json:"upload_key" db:"upload_key"`
+	Number    int       `json:"number" db:"number"`
+	Position  int       `json:"position" db:"position"`
+	Alt       string    `json:"alt" db:"alt"`
+	Caption   string    `json:"caption" db:"caption"`
+	Cover     bool      `json:"cover" db:"cover"`
+}
+
+type Attachments []Attachment
+
+// AttachmentShortcode matches the attachments embedded in a post content.
+var AttachmentShortcode = regexp.MustCompile(`\[\[attachment:(\d+)\]\]`)
+
+// AttachmentEdit holds the changes made to an attachment by the post
+// form.
+type AttachmentEdit struct {
+	ID       string
+	Alt      string
+	Caption  string
+	Position int
+	Remove   bool
+}
+
+// Attachments returns the gallery of the post, in order.
+func (p *Post) Attachments(tx *pop.Connection) (Attachments, error) {
+	list := Attachments{}
+	err := tx.Where("post_id = ?", p.ID).Order("position asc, number asc").All(&list)
+	return list, errors.WithStack(err)
+}
+
+// Number returns the attachment embedded as [[attachment:n]].
+func (as Attachments) Number(n int) (Attachment, bool) {
+	for _, a := range as {
+		if a.Number == n {
+			return a, true
+		}
+	}
+	return Attachment{}, false
+}
+
+// Keys lists the uploads of the attachments.
+func (as Attachments) Keys() []string {
+	keys := make([]string, len(as))
+	for i, a := range as {
+		keys[i] = a.UploadKey
+	}
+	return keys
+}
+
+// Shortcode is what embeds the attachment in the post content.
+func (a Attachment) Shortcode() string {
+	return "[[attachment:" + strconv.Itoa(a.Number) + "]]"
+}
+
+// StripShortcodes removes the embedded attachments from content, for
+// excerpts.
+func StripShortcodes(content string) string {
+	return AttachmentShortcode.ReplaceAllString(content, "")
+}
+
+// ExpandShortcodes replaces the embedded attachments of content by what
+// embed returns for them. Unknown attachments are removed.
+func ExpandShortcodes(content string, as Attachments, embed func(Attachment) string) string {
+	return AttachmentShortcode.ReplaceAllStringFunc(content, func(code string) string {
+		n, _ := strconv.Atoi(AttachmentShortcode.FindStringSubmatch(code)[1])
+		a, ok := as.Number(n)
+		if !ok {
+			return ""
+		}
+		return embed(a)
+	})
+}
+
+// Attach checks and stores uploaded images as new attachments of the
+// post, after the existing ones. Refused images are kept in Rejections.
+// A form with more than MaxFiles images attaches none of them.
+func (p *Post) Attach(tx *pop.Connection, limits UploadLimits, files []binding.File) (Attachments, *validate.Errors, error) {
+	verrs := validate.NewErrors()
+	added := Attachments{}
+	sent := []binding.File{}
+	for _, f := range files {
+		if fileSent(f) {
+			sent = append(sent, f)
+		}
+	}
+	if limits.MaxFiles > 0 && len(sent) > limits.MaxFiles {
+		verrs.Add("Attachments", fmt.Sprintf("Attach at most %d images at once.", limits.MaxFiles))
+		return added, verrs, nil
+	}
+
+	for _, f := range sent {
+		content, ext, rejection, err := limits.CheckImage(f)
+		if err != nil {
+			return added, verrs, err
+		}
+		if rejection != nil {
+			rejection.UserID = nulls.NewUUID(p.AuthorID)
+			p.Rejections = append(p.Rejections, rejection)
+			verrs.Add("Attachments", f.Filename+": "+rejection.Reason)
+			continue
+		}
+		u, err := StoreUpload(tx, bytes.NewReader(content), ext)
+		if err != nil {
+			return added, verrs, err
+		}
+		a, err := p.attach(tx, u.Key)
+		if err != nil {
+			return added, verrs, err
+		}
+		added = append(added, *a)
+	}
+	return added, verrs, nil
+}
+
+// attach adds the upload key to the gallery of the post, unless it is
+// already in it.
+func (p *Post) attach(tx *pop.Connection, key string) (*Attachment, error) {
+	a := &Attachment{}
+	err := tx.Where("post_id = ? AND upload_key = ?", p.ID, key).First(a)
+	if err == nil {
+		return a, nil
+	}
+	if errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+
+	next := struct {
+		Number   int `db:"number"`
+		Position int `db:"position"`
+	}{}
+	err = tx.RawQuery("SELECT COALESCE(MAX(number), 0) + 1 AS number, COALESCE(MAX(position), 0) + 1 AS position "+
+		"FROM attachments WHERE post_id = ?", p.ID).First(&next)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	a = &Attachment{
+		PostID:    p.ID,
+		UploadKey: key,
+		Number:    next.Number,
+		Position:  next.Position,
+		Cover:     key == p.FileName,
+	}
+	verrs, err := tx.ValidateAndCreate(a)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if verrs.HasAny() {
+		return nil, errors.New(verrs.Error())
+	}
+	return a, AcquireUpload(tx, key)
+}
+
+// EditAttachments applies the changes of the post form to the gallery.
+// coverID names the attachment to show as the image of the post, the post
+// itself is saved by the caller.
+func (p *Post) EditAttachments(tx *pop.Connection, edits []AttachmentEdit, coverID string) error {
+	list, err := p.Attachments(tx)
+	if err != nil {
+		return err
+	}
+	byID := map[string]AttachmentEdit{}
+	for _, e := range edits {
+		byID[e.ID] = e
+	}
+
+	kept := Attachments{}
+	for _, a := range list {
+		e, ok := byID[a.ID.String()]
+		if ok && e.Remove {
+			if err := a.remove(tx); err != nil {
+				return err
+			}
+			if a.UploadKey == p.FileName {
+				p.FileName = ""
+			}
+			continue
+		}
+		if ok {
+			a.Alt = strings.TrimSpace(e.Alt)
+			a.Caption = strings.TrimSpace(e.Caption)
+			a.Position = e.Position
+			if err := tx.Update(&a); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		kept = append(kept, a)
+		if a.ID.String() == coverID {
+			p.FileName = a.UploadKey
+		}
+	}
+	// A removed cover is replaced by the first image left
+	if p.FileName == "" && len(kept) > 0 {
+		p.FileName = kept[0].UploadKey
+	}
+	return nil
+}
+
+// remove drops the attachment and its reference to the upload.
+func (a *Attachment) remove(tx *pop.Connection) error {
+	if err := tx.Destroy(a); err != nil {
+		return errors.WithStack(err)
+	}
+	return ReleaseUpload(tx, a.UploadKey)
+}
+
+// syncCover flags the attachment showing the image of the post as its
+// cover.
+func (p *Post) syncCover(tx *pop.Connection) error {
+	err := tx.RawQuery("UPDATE attachments SET cover = (upload_key = ?) WHERE post_id = ?", p.FileName, p.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+func (a *Attachment) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: a.UploadKey, Name: "UploadKey"},
+		&validators.StringLengthInRange{Field: a.Alt, Name: "Alt", Max: 255},
+	), nil
+}
@@ -0,0 +1,110 @@
+package models_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+
+	"github.com/gobuffalo/buffalo/binding"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+// pngUpload is an uploaded png file of a single color.
+func (ms *ModelSuite) pngUpload(name string, c color.Color) binding.File {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.Set(i%4, i/4, c)
+	}
+	buf := &bytes.Buffer{}
+	ms.NoError(png.Encode(buf, img))
+	return models.UploadedFile(name, buf.Bytes())
+}
+
+func (ms *ModelSuite) Test_Post_Attachments() {
+	defer ms.tempStorage()()
+	limits := models.UploadLimits{MaxBytes: 1 << 20}
+
+	post := &models.Post{Title: "Gallery", Content: "[[attachment:2]]", Status: models.PostDraft}
+	post.FileImage = ms.pngUpload("cover.png", color.White)
+	verrs, err := post.UploadAndCreate(ms.DB, limits)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	added, verrs, err := post.Attach(ms.DB, limits, []binding.File{
+		ms.pngUpload("second.png", color.Black),
+		ms.pngUpload("notes.png", color.White),
+	})
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	// The same image is not attached twice
+	ms.Len(added, 2)
+	ms.Equal(1, added[1].Number)
+
+	list, err := post.Attachments(ms.DB)
+	ms.NoError(err)
+	ms.Len(list, 2)
+	ms.True(list[0].Cover)
+	ms.Equal(post.FileName, list[0].UploadKey)
+	ms.Equal(2, list[1].Number)
+
+	// Removing the cover makes the next image the cover
+	ms.NoError(post.EditAttachments(ms.DB, []models.AttachmentEdit{
+		{ID: list[0].ID.String(), Remove: true},
+		{ID: list[1].ID.String(), Alt: " Black ", Position: 1},
+	}, ""))
+	verrs, err = post.Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.Equal(list[1].UploadKey, post.FileName)
+
+	list, err = post.Attachments(ms.DB)
+	ms.NoError(err)
+	ms.Len(list, 1)
+	ms.True(list[0].Cover)
+	ms.Equal("Black", list[0].Alt)
+
+	content := models.ExpandShortcodes(post.Content+" [[attachment:1]]", list, func(a models.Attachment) string {
+		return a.Alt
+	})
+	ms.Equal("Black ", content)
+
+	// Nothing references the removed image anymore
+	collected, err := models.CollectUploads(ms.DB)
+	ms.NoError(err)
+	ms.Equal(1, collected)
+}
+
+func (ms *ModelSuite) Test_Post_Attach_Limits() {
+	defer ms.tempStorage()()
+	limits := models.UploadLimits{MaxBytes: 1 << 20, MaxFiles: 2}
+
+	post := &models.Post{Title: "Limited", Content: "content", Status: models.PostDraft}
+	post.FileImage = ms.pngUpload("cover.png", color.White)
+	verrs, err := post.UploadAndCreate(ms.DB, limits)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	// Empty inputs don't count
+	added, verrs, err := post.Attach(ms.DB, limits, []binding.File{
+		ms.pngUpload("second.png", color.Black),
+		{},
+		ms.pngUpload("third.png", color.Black),
+		ms.pngUpload("fourth.png", color.White),
+	})
+	ms.NoError(err)
+	ms.Len(added, 0)
+	ms.Equal([]string{"Attach at most 2 images at once."}, verrs.Get("Attachments"))
+
+	// Every refused image is kept, not only the last one
+	added, verrs, err = post.Attach(ms.DB, limits, []binding.File{
+		models.UploadedFile("notes.txt", []byte("notes")),
+		models.UploadedFile("script.png", []byte("<script>alert(1)</script>")),
+	})
+	ms.NoError(err)
+	ms.Len(added, 0)
+	ms.Len(verrs.Get("Attachments"), 2)
+	ms.Len(post.Rejections, 2)
+	ms.Equal("notes.txt", post.Rejections[0].Filename)
+	ms.Equal("script.png", post.Rejections[1].Filename)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Audited actions.
+const (
+	AuditLoginLocked   = "login.locked"
+	AuditLoginUnlocked = "login.unlocked"
+)
+
+// AuditEvent records a security related event.
+type AuditEvent struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	Action    string     `json:"action" db:"action"`
+	UserID    nulls.UUID `json:"user_id" db:"user_id"`
+	ActorID   nulls.UUID `json:"actor_id" db:"actor_id"`
+	IP        string     `json:"ip" db:"ip"`
+	Details   string     `json:"details" db:"details"`
+}
+
+type AuditEvents []AuditEvent
+
+// RecordAudit saves an audit event. Pass models.DB rather than the
+// transaction of a request that may be rolled back.
+func RecordAudit(tx *pop.Connection, e *AuditEvent) error {
+	return errors.WithStack(tx.Create(e))
+}
@@ -4,25 +4,45 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
 )
 
 type Comment struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
-	Content   string    `json:"content" db:"content"`
-	AuthorID  uuid.UUID `json:"author_id" db:"author_id"`
-	PostID    uuid.UUID `json:"post_id" db:"post_id"`
-	Author    User      `json:"-" db:"-"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	Content    string     `json:"content" db:"content"`
+	AuthorID   uuid.UUID  `json:"author_id" db:"author_id"`
+	PostID     uuid.UUID  `json:"post_id" db:"post_id"`
+	ParentID   nulls.UUID `json:"parent_id" db:"parent_id"`
+	DeletedAt  nulls.Time `json:"deleted_at" db:"deleted_at"`
+	Status     string     `json:"status" db:"status"`
+	SpamScore  float64    `json:"-" db:"spam_score"`
+	SpamReason string     `json:"-" db:"spam_reason"`
+	Author     User       `json:"-" db:"-"`
+	Depth      int        `json:"-" db:"-"`
 }
 
 type Comments []Comment
 
+// Comment statuses. Only approved comments are visible to readers, pending
+// comments wait for a moderator.
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+	CommentRejected = "rejected"
+)
+
+// CommentStatuses lists every status a comment can be in.
+var CommentStatuses = []string{CommentPending, CommentApproved, CommentSpam, CommentRejected}
+
 func (c *Comment) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.Validate(
 		&validators.StringIsPresent{Field: c.Content, Name: "Content"},
+		&validators.StringInclusion{Field: c.Status, Name: "Status", List: CommentStatuses},
 	), nil
 }
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// IsPending reports whether the comment waits for a moderator.
+func (c Comment) IsPending() bool {
+	return c.Status == CommentPending
+}
+
+// SetInitialStatus approves the new comment of author, unless the site
+// holds first comments and author never had one approved. Moderators are
+// always approved.
+func (c *Comment) SetInitialStatus(tx *pop.Connection, author *User) error {
+	c.Status = CommentApproved
+	if author.Can(PermCommentModerate) {
+		return nil
+	}
+	hold, err := SettingOn(tx, SettingFirstCommentApproval)
+	if err != nil || !hold {
+		return err
+	}
+	approved, err := tx.Where("author_id = ? AND status = ?", author.ID, CommentApproved).Count(&Comment{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if approved == 0 {
+		c.Status = CommentPending
+	}
+	return nil
+}
+
+// VisibleComments restricts q to the comments the user can read: the
+// approved ones, and the pending ones to their author and moderators.
+func VisibleComments(q *pop.Query, u *User) *pop.Query {
+	if u.Can(PermCommentModerate) {
+		return q.Where("status IN (?, ?)", CommentApproved, CommentPending)
+	}
+	if u != nil {
+		return q.Where("(status = ? OR (status = ? AND author_id = ?))", CommentApproved, CommentPending, u.ID)
+	}
+	return q.Where("status = ?", CommentApproved)
+}
+
+// ModerateComments sets the status of the comments ids and returns the
+// ones that changed.
+func ModerateComments(tx *pop.Connection, ids []string, status string) (Comments, error) {
+	valid := false
+	for _, s := range CommentStatuses {
+		valid = valid || s == status
+	}
+	if !valid {
+		return nil, errors.Errorf("unknown comment status %q", status)
+	}
+
+	changed := Comments{}
+	for _, id := range ids {
+		comment := &Comment{}
+		if err := tx.Find(comment, id); err != nil {
+			continue
+		}
+		if comment.Status == status {
+			continue
+		}
+		comment.Status = status
+		if err := tx.Update(comment); err != nil {
+			return changed, errors.WithStack(err)
+		}
+		changed = append(changed, *comment)
+	}
+	return changed, nil
+}
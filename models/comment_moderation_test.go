@@ -0,0 +1,44 @@
+package models_test
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (ms *ModelSuite) Test_Comment_Moderation() {
+	author := &models.User{Name: "Newcomer", Email: "newcomer@example.com", Role: models.RoleCommenter}
+	ms.NoError(author.OAuthAndSave(ms.DB))
+	stranger := &models.User{Name: "Stranger", Email: "stranger@example.com", Role: models.RoleCommenter}
+	ms.NoError(stranger.OAuthAndSave(ms.DB))
+	moderator := &models.User{Role: models.RoleEditor}
+	postID := ms.uuid()
+
+	// Comments are approved until the site holds first comments
+	first := &models.Comment{Content: "first", AuthorID: author.ID, PostID: postID}
+	ms.NoError(first.SetInitialStatus(ms.DB, author))
+	ms.Equal(models.CommentApproved, first.Status)
+
+	ms.NoError(models.SaveSetting(ms.DB, models.SettingFirstCommentApproval, "true"))
+	ms.NoError(first.SetInitialStatus(ms.DB, author))
+	ms.Equal(models.CommentPending, first.Status)
+	ms.NoError(ms.DB.Create(first))
+
+	visible := func(u *models.User) int {
+		count, err := models.VisibleComments(ms.DB.Where("post_id = ?", postID), u).Count(&models.Comment{})
+		ms.NoError(err)
+		return count
+	}
+	ms.Equal(1, visible(author))
+	ms.Equal(1, visible(moderator))
+	ms.Equal(0, visible(stranger))
+	ms.Equal(0, visible(nil))
+
+	changed, err := models.ModerateComments(ms.DB, []string{first.ID.String()}, models.CommentApproved)
+	ms.NoError(err)
+	ms.Len(changed, 1)
+	ms.Equal(1, visible(nil))
+	_, err = models.ModerateComments(ms.DB, []string{first.ID.String()}, "published")
+	ms.Error(err)
+
+	// Once approved, the author is trusted
+	second := &models.Comment{Content: "second", AuthorID: author.ID, PostID: postID}
+	ms.NoError(second.SetInitialStatus(ms.DB, author))
+	ms.Equal(models.CommentApproved, second.Status)
+}
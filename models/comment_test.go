@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_Comment_Remove() {
+	postID := ms.uuid()
+	create := func(parent *models.Comment) *models.Comment {
+		c := &models.Comment{Content: "hello", AuthorID: ms.uuid(), PostID: postID, Status: models.CommentApproved}
+		if parent != nil {
+			c.ParentID = nulls.NewUUID(parent.ID)
+		}
+		ms.NoError(ms.DB.Create(c))
+		return c
+	}
+	root := create(nil)
+	reply := create(root)
+	now := time.Now()
+
+	// Replies keep their parent as a placeholder
+	ms.NoError(root.Remove(ms.DB, now))
+	ms.NoError(ms.DB.Reload(root))
+	ms.True(root.IsDeleted())
+	ms.Equal(models.DeletedCommentContent, root.Content)
+	_, err := models.FindReplyParent(ms.DB, postID, root.ID.String())
+	ms.Error(err)
+
+	// The placeholder goes with its last reply
+	ms.NoError(reply.Remove(ms.DB, now))
+	count, err := ms.DB.Where("post_id = ?", postID).Count(&models.Comment{})
+	ms.NoError(err)
+	ms.Equal(0, count)
+}
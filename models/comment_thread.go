@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+)
+
+// DeletedCommentContent replaces the content of deleted comments that are
+// kept because of their replies.
+const DeletedCommentContent = "[deleted]"
+
+// IsDeleted reports whether the comment is only kept as a placeholder.
+func (c Comment) IsDeleted() bool {
+	return c.DeletedAt.Valid
+}
+
+// ThreadComments orders the comments of a post as a thread: every comment
+// is followed by its replies, oldest first, and Depth is set to its
+// nesting level. Replies nested deeper than maxDepth are shown at
+// maxDepth. Comments whose parent is missing are shown at the top level.
+func ThreadComments(comments Comments, maxDepth int) Comments {
+	sorted := make(Comments, len(comments))
+	copy(sorted, comments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	known := map[string]bool{}
+	for _, c := range sorted {
+		known[c.ID.String()] = true
+	}
+	replies := map[string]Comments{}
+	roots := Comments{}
+	for _, c := range sorted {
+		if c.ParentID.Valid && known[c.ParentID.UUID.String()] {
+			parent := c.ParentID.UUID.String()
+			replies[parent] = append(replies[parent], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	thread := make(Comments, 0, len(sorted))
+	var walk func(cs Comments, depth int)
+	walk = func(cs Comments, depth int) {
+		for _, c := range cs {
+			c.Depth = depth
+			thread = append(thread, c)
+			next := depth + 1
+			if next > maxDepth {
+				next = maxDepth
+			}
+			walk(replies[c.ID.String()], next)
+		}
+	}
+	walk(roots, 0)
+	return thread
+}
+
+// FindReplyParent finds the comment of the post a reply is written to.
+// Deleted comments can not be replied to.
+func FindReplyParent(tx *pop.Connection, postID interface{}, id string) (*Comment, error) {
+	parent := &Comment{}
+	err := tx.Where("id = ? AND post_id = ? AND deleted_at IS NULL", id, postID).First(parent)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return parent, nil
+}
+
+// Remove deletes the comment. A comment with replies is kept as a
+// placeholder so the thread still reads, and placeholders left without
+// replies are removed with it.
+func (c *Comment) Remove(tx *pop.Connection, now time.Time) error {
+	count, err := tx.Where("parent_id = ?", c.ID).Count(&Comment{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if count > 0 {
+		c.Content = DeletedCommentContent
+		c.DeletedAt = nulls.NewTime(now)
+		return errors.WithStack(tx.Update(c))
+	}
+	if err := tx.Destroy(c); err != nil {
+		return errors.WithStack(err)
+	}
+	if !c.ParentID.Valid {
+		return nil
+	}
+
+	parent := &Comment{}
+	err = tx.Where("id = ? AND deleted_at IS NOT NULL", c.ParentID.UUID).First(parent)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return parent.Remove(tx, now)
+}
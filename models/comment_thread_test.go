@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+)
+
+func Test_ThreadComments(t *testing.T) {
+	now := time.Now()
+	comment := func(parent *Comment, minutes int) Comment {
+		c := Comment{ID: uuid.Must(uuid.NewV4()), CreatedAt: now.Add(time.Duration(minutes) * time.Minute)}
+		if parent != nil {
+			c.ParentID = nulls.NewUUID(parent.ID)
+		}
+		return c
+	}
+	first := comment(nil, 0)
+	second := comment(nil, 1)
+	reply := comment(&first, 2)
+	nested := comment(&reply, 3)
+	deeper := comment(&nested, 4)
+	orphan := comment(&Comment{ID: uuid.Must(uuid.NewV4())}, 5)
+
+	thread := ThreadComments(Comments{orphan, deeper, second, nested, reply, first}, 2)
+	expected := []struct {
+		id    uuid.UUID
+		depth int
+	}{
+		{first.ID, 0}, {reply.ID, 1}, {nested.ID, 2}, {deeper.ID, 2}, {second.ID, 0}, {orphan.ID, 0},
+	}
+	if len(thread) != len(expected) {
+		t.Fatalf("expected %d comments, got %d", len(expected), len(thread))
+	}
+	for i, e := range expected {
+		if thread[i].ID != e.id || thread[i].Depth != e.depth {
+			t.Fatalf("comment %d: expected %s at depth %d, got %s at depth %d", i, e.id, e.depth, thread[i].ID, thread[i].Depth)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Job statuses. Finished jobs are deleted, dead ones failed every attempt
+// and wait for an admin.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDead    = "dead"
+)
+
+// JobStatuses lists every status a job can be in.
+var JobStatuses = []string{JobQueued, JobRunning, JobDead}
+
+// JobMaxAttempts is how many times a job is tried before it is dead.
+const JobMaxAttempts = 5
+
+// Job is a unit of background work waiting in the queue.
+type Job struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Queue       string     `json:"queue" db:"queue"`
+	Handler     string     `json:"handler" db:"handler"`
+	Args        string     `json:"args" db:"args"`
+	Status      string     `json:"status" db:"status"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	MaxAttempts int        `json:"max_attempts" db:"max_attempts"`
+	RunAt       time.Time  `json:"run_at" db:"run_at"`
+	LockedAt    nulls.Time `json:"locked_at" db:"locked_at"`
+	LastError   string     `json:"last_error" db:"last_error"`
+}
+
+type Jobs []Job
+
+// EnqueueJob queues a job of handler to run from runAt. Queued within a
+// transaction, the job only exists once it commits.
+func EnqueueJob(tx *pop.Connection, queue, handler string, args map[string]interface{}, runAt time.Time) (*Job, error) {
+	if queue == "" {
+		queue = "default"
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	j := &Job{
+		Queue:       queue,
+		Handler:     handler,
+		Args:        string(b),
+		Status:      JobQueued,
+		MaxAttempts: JobMaxAttempts,
+		RunAt:       runAt,
+	}
+	return j, errors.WithStack(tx.Create(j))
+}
+
+// ClaimJob locks the next job due to run and counts the attempt, or
+// returns nil when there is none. Running jobs locked since before stale
+// were abandoned by a stopped worker and are claimed again.
+func ClaimJob(tx *pop.Connection, now, stale time.Time) (*Job, error) {
+	j := &Job{}
+	err := tx.RawQuery("UPDATE jobs SET status = ?, locked_at = ?, attempts = attempts + 1, updated_at = ? "+
+		"WHERE id = (SELECT id FROM jobs WHERE (status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?) "+
+		"ORDER BY run_at LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING *",
+		JobRunning, now, now, JobQueued, now, JobRunning, stale).First(j)
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return j, nil
+}
+
+// Decode returns the arguments of the job.
+func (j *Job) Decode() (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	err := json.Unmarshal([]byte(j.Args), &args)
+	return args, errors.WithStack(err)
+}
+
+// Complete removes the finished job from the queue.
+func (j *Job) Complete(tx *pop.Connection) error {
+	return errors.WithStack(tx.Destroy(j))
+}
+
+// JobBackoff is the wait before the next try of a job that failed
+// attempts times: 30 seconds doubled after each failure, up to 6 hours.
+func JobBackoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+// Fail records the error of the attempt and queues the job again after
+// its backoff, or marks it dead once it ran out of attempts.
+func (j *Job) Fail(tx *pop.Connection, cause error, now time.Time) error {
+	j.LastError = cause.Error()
+	j.LockedAt = nulls.Time{}
+	if j.Attempts >= j.MaxAttempts {
+		j.Status = JobDead
+	} else {
+		j.Status = JobQueued
+		j.RunAt = now.Add(JobBackoff(j.Attempts))
+	}
+	return errors.WithStack(tx.Update(j))
+}
+
+// Retry queues a dead job again with all its attempts.
+func (j *Job) Retry(tx *pop.Connection, now time.Time) error {
+	j.Status = JobQueued
+	j.Attempts = 0
+	j.RunAt = now
+	j.LockedAt = nulls.Time{}
+	return errors.WithStack(tx.Update(j))
+}
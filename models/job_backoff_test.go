@@ -0,0 +1,20 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_JobBackoff(t *testing.T) {
+	expected := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		20: 6 * time.Hour,
+	}
+	for attempts, d := range expected {
+		if got := JobBackoff(attempts); got != d {
+			t.Fatalf("attempt %d: expected %s, got %s", attempts, d, got)
+		}
+	}
+}
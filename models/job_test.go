@@ -0,0 +1,56 @@
+package models_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_Job_Lifecycle() {
+	now := time.Now()
+	_, err := models.EnqueueJob(ms.DB, "", "later", nil, now.Add(time.Hour))
+	ms.NoError(err)
+	queued, err := models.EnqueueJob(ms.DB, "", "now", map[string]interface{}{"id": 7}, now)
+	ms.NoError(err)
+
+	j, err := models.ClaimJob(ms.DB, now, now.Add(-time.Minute))
+	ms.NoError(err)
+	ms.Equal(queued.ID, j.ID)
+	ms.Equal(models.JobRunning, j.Status)
+	ms.Equal(1, j.Attempts)
+	args, err := j.Decode()
+	ms.NoError(err)
+	ms.Equal(float64(7), args["id"])
+
+	// Nothing else is due
+	none, err := models.ClaimJob(ms.DB, now, now.Add(-time.Minute))
+	ms.NoError(err)
+	ms.Nil(none)
+
+	// Failures back off, then the job is dead
+	ms.NoError(j.Fail(ms.DB, errors.New("smtp down"), now))
+	ms.Equal(models.JobQueued, j.Status)
+	ms.Equal(now.Add(models.JobBackoff(1)), j.RunAt)
+	j.Attempts = j.MaxAttempts
+	ms.NoError(j.Fail(ms.DB, errors.New("smtp down"), now))
+	ms.NoError(ms.DB.Reload(j))
+	ms.Equal(models.JobDead, j.Status)
+	ms.Equal("smtp down", j.LastError)
+
+	ms.NoError(j.Retry(ms.DB, now))
+	j, err = models.ClaimJob(ms.DB, now, now.Add(-time.Minute))
+	ms.NoError(err)
+	ms.Equal(queued.ID, j.ID)
+	ms.Equal(1, j.Attempts)
+	ms.NoError(j.Complete(ms.DB))
+
+	// Jobs abandoned by a stopped worker are claimed again
+	later, err := models.ClaimJob(ms.DB, now.Add(2*time.Hour), now.Add(-time.Minute))
+	ms.NoError(err)
+	ms.Equal("later", later.Handler)
+	again, err := models.ClaimJob(ms.DB, now.Add(2*time.Hour), now.Add(3*time.Hour))
+	ms.NoError(err)
+	ms.Equal(later.ID, again.ID)
+	ms.Equal(2, again.Attempts)
+}
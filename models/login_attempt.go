@@ -0,0 +1,223 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// AttemptStore keeps the failed login attempts of accounts and addresses.
+type AttemptStore interface {
+	// Get returns the number of failures of key and the time of the last
+	// one, zero values when there are none.
+	Get(key string) (int, time.Time, error)
+	// Fail counts a failure of key at now, after forgetting the previous
+	// ones when the last is older than expiry. It returns the failures
+	// counted, and must be atomic for concurrent attempts.
+	Fail(key string, now time.Time, expiry time.Duration) (int, error)
+	// Delete forgets the failures of key.
+	Delete(key string) error
+}
+
+// LoginLimit is the failed attempts policy of a kind of key.
+type LoginLimit struct {
+	// Threshold is the number of failures locking the key out.
+	Threshold int
+	// Backoff is the wait after the first failure, doubled after each
+	// following one. Zero disables it.
+	Backoff time.Duration
+	// Lockout is how long a key stays locked out. Failures are also
+	// forgotten after that long without any.
+	Lockout time.Duration
+}
+
+// wait returns how long to wait after failures, the last one at last.
+func (l LoginLimit) wait(failures int, last, now time.Time) time.Duration {
+	if failures == 0 || now.Sub(last) >= l.Lockout {
+		return 0
+	}
+	d := l.Lockout
+	if failures < l.Threshold {
+		if l.Backoff == 0 {
+			return 0
+		}
+		d = l.Backoff << uint(failures-1)
+		if d <= 0 || d > l.Lockout {
+			d = l.Lockout
+		}
+	}
+	if wait := last.Add(d).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// LoginThrottle slows down password guessing with per account and per
+// address counters of failed attempts.
+type LoginThrottle struct {
+	Store   AttemptStore
+	Account LoginLimit
+	IP      LoginLimit
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Wait returns how long the next login attempt for email from ip must
+// wait.
+func (t *LoginThrottle) Wait(email, ip string, now time.Time) (time.Duration, error) {
+	account, err := t.wait(accountKey(email), t.Account, now)
+	if err != nil {
+		return 0, err
+	}
+	addr, err := t.wait(ipKey(ip), t.IP, now)
+	if addr > account {
+		return addr, err
+	}
+	return account, err
+}
+
+func (t *LoginThrottle) wait(key string, limit LoginLimit, now time.Time) (time.Duration, error) {
+	failures, last, err := t.Store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return limit.wait(failures, last, now), nil
+}
+
+// Fail records a failed attempt for email from ip. It reports whether the
+// account just got locked out.
+func (t *LoginThrottle) Fail(email, ip string, now time.Time) (bool, error) {
+	if _, err := t.fail(ipKey(ip), t.IP, now); err != nil {
+		return false, err
+	}
+	failures, err := t.fail(accountKey(email), t.Account, now)
+	return failures == t.Account.Threshold, err
+}
+
+func (t *LoginThrottle) fail(key string, limit LoginLimit, now time.Time) (int, error) {
+	return t.Store.Fail(key, now, limit.Lockout)
+}
+
+// Locked reports whether the account of email is locked out.
+func (t *LoginThrottle) Locked(email string, now time.Time) (bool, error) {
+	failures, last, err := t.Store.Get(accountKey(email))
+	if err != nil {
+		return false, err
+	}
+	return failures >= t.Account.Threshold && now.Sub(last) < t.Account.Lockout, nil
+}
+
+// Unlock forgets the failed attempts of the account of email, after a
+// successful login or to lift a lockout.
+func (t *LoginThrottle) Unlock(email string) error {
+	return t.Store.Delete(accountKey(email))
+}
+
+// LoginAttempt counts the failed login attempts of a key in the database.
+type LoginAttempt struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	Key          string    `json:"key" db:"key"`
+	Failures     int       `json:"failures" db:"failures"`
+	LastFailedAt time.Time `json:"last_failed_at" db:"last_failed_at"`
+}
+
+// DBAttemptStore keeps the failed attempts in the login_attempts table.
+// It should not use the transaction of the request, which is rolled back
+// when the login fails.
+type DBAttemptStore struct {
+	DB *pop.Connection
+}
+
+// Get implements AttemptStore.
+func (s DBAttemptStore) Get(key string) (int, time.Time, error) {
+	a := &LoginAttempt{}
+	if err := s.DB.Where("key = ?", key).First(a); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, errors.WithStack(err)
+	}
+	return a.Failures, a.LastFailedAt, nil
+}
+
+// Fail implements AttemptStore. The failures are counted by a single
+// statement, concurrent attempts all count.
+func (s DBAttemptStore) Fail(key string, now time.Time, expiry time.Duration) (int, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	a := &LoginAttempt{}
+	err = s.DB.RawQuery("INSERT INTO login_attempts (id, key, failures, last_failed_at, created_at, updated_at) "+
+		"VALUES (?, ?, 1, ?, ?, ?) ON CONFLICT (key) DO UPDATE SET "+
+		"failures = CASE WHEN login_attempts.last_failed_at <= ? THEN 1 ELSE login_attempts.failures + 1 END, "+
+		"last_failed_at = EXCLUDED.last_failed_at, updated_at = EXCLUDED.updated_at RETURNING failures",
+		id, key, now, now, now, now.Add(-expiry)).First(a)
+	return a.Failures, errors.WithStack(err)
+}
+
+// Delete implements AttemptStore.
+func (s DBAttemptStore) Delete(key string) error {
+	err := s.DB.RawQuery("DELETE FROM login_attempts WHERE key = ?", key).Exec()
+	return errors.WithStack(err)
+}
+
+// MemoryAttemptStore keeps the failed attempts in memory, for tests and
+// single process deployments.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]memoryAttempt
+}
+
+type memoryAttempt struct {
+	failures int
+	last     time.Time
+}
+
+// NewMemoryAttemptStore returns an empty MemoryAttemptStore.
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: map[string]memoryAttempt{}}
+}
+
+// Get implements AttemptStore.
+func (s *MemoryAttemptStore) Get(key string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	return a.failures, a.last, nil
+}
+
+// Fail implements AttemptStore.
+func (s *MemoryAttemptStore) Fail(key string, now time.Time, expiry time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.attempts[key]
+	if now.Sub(a.last) >= expiry {
+		a.failures = 0
+	}
+	a.failures++
+	a.last = now
+	s.attempts[key] = a
+	return a.failures, nil
+}
+
+// Delete implements AttemptStore.
+func (s *MemoryAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
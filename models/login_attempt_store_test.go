@@ -0,0 +1,26 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_DBAttemptStore_Fail() {
+	store := models.DBAttemptStore{DB: ms.DB}
+	now := time.Now().Truncate(time.Second)
+
+	for expected := 1; expected <= 3; expected++ {
+		failures, err := store.Fail("account:someone@example.com", now, time.Minute)
+		ms.NoError(err)
+		ms.Equal(expected, failures)
+	}
+	failures, _, err := store.Get("account:someone@example.com")
+	ms.NoError(err)
+	ms.Equal(3, failures)
+
+	// Failures older than the expiry are forgotten
+	failures, err = store.Fail("account:someone@example.com", now.Add(time.Minute), time.Minute)
+	ms.NoError(err)
+	ms.Equal(1, failures)
+}
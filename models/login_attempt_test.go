@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_LoginThrottle(t *testing.T) {
+	throttle := &LoginThrottle{
+		Store:   NewMemoryAttemptStore(),
+		Account: LoginLimit{Threshold: 3, Backoff: time.Second, Lockout: time.Minute},
+		IP:      LoginLimit{Threshold: 10, Lockout: time.Minute},
+	}
+	now := time.Date(2018, 9, 26, 12, 0, 0, 0, time.UTC)
+	wait := func(at time.Time) time.Duration {
+		d, err := throttle.Wait("Someone@example.com", "10.0.0.1", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	fail := func(at time.Time) bool {
+		locked, err := throttle.Fail("someone@example.com", "10.0.0.1", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return locked
+	}
+
+	if fail(now) || wait(now) != time.Second {
+		t.Fatal("the first failure should wait a second")
+	}
+	if fail(now) || wait(now) != 2*time.Second {
+		t.Fatal("the wait should double after each failure")
+	}
+	if !fail(now) || wait(now) != time.Minute {
+		t.Fatal("the third failure should lock the account out")
+	}
+	if locked, _ := throttle.Locked("someone@example.com", now); !locked {
+		t.Fatal("the account should be reported locked")
+	}
+	if wait(now.Add(time.Minute)) != 0 {
+		t.Fatal("the lockout should expire")
+	}
+	if fail(now.Add(time.Minute)) || wait(now.Add(time.Minute)) != time.Second {
+		t.Fatal("failures should be forgotten after the lockout")
+	}
+
+	if err := throttle.Unlock("someone@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if wait(now.Add(time.Minute)) != 0 {
+		t.Fatal("unlocking should forget the failures")
+	}
+}
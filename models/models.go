@@ -20,3 +20,17 @@ func init() {
 	}
 	pop.Debug = env == "development"
 }
+
+// Secret reads a signing key from the environment. Development and test
+// fall back to fallback, any other environment refuses to start without
+// the key, since a known key lets anyone forge what it signs.
+func Secret(key, fallback string) []byte {
+	if s := envy.Get(key, ""); s != "" {
+		return []byte(s)
+	}
+	env := envy.Get("GO_ENV", "development")
+	if env != "development" && env != "test" {
+		log.Fatalf("%s must be set in the %s environment", key, env)
+	}
+	return []byte(fallback)
+}
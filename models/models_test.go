@@ -5,6 +5,7 @@ import (
 
 	"github.com/gobuffalo/packr"
 	"github.com/gobuffalo/suite"
+	"github.com/gobuffalo/uuid"
 )
 
 type ModelSuite struct {
@@ -22,3 +23,10 @@ func Test_ModelSuite(t *testing.T) {
 	}
 	suite.Run(t, as)
 }
+
+// uuid returns a new random id.
+func (ms *ModelSuite) uuid() uuid.UUID {
+	id, err := uuid.NewV4()
+	ms.NoError(err)
+	return id
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// How users want to hear about comments.
+const (
+	NotifyInstant = "instant"
+	NotifyDigest  = "digest"
+	NotifyOff     = "off"
+)
+
+// NotifyChoices lists every notification preference.
+var NotifyChoices = []string{NotifyInstant, NotifyDigest, NotifyOff}
+
+// Kinds of notifications.
+const (
+	// NotificationComment tells an author about a comment on their post.
+	NotificationComment = "comment"
+	// NotificationReply tells a commenter about a reply to their comment.
+	NotificationReply = "reply"
+)
+
+// DigestInterval is how often digests are sent.
+const DigestInterval = 24 * time.Hour
+
+// Notification is a comment a user has to hear about. Instant ones are
+// sent right away, the others wait for the daily digest.
+type Notification struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	CommentID uuid.UUID  `json:"comment_id" db:"comment_id"`
+	Kind      string     `json:"kind" db:"kind"`
+	Digest    bool       `json:"digest" db:"digest"`
+	SentAt    nulls.Time `json:"sent_at" db:"sent_at"`
+}
+
+type Notifications []Notification
+
+// NotificationItem is a notification with what its email shows.
+type NotificationItem struct {
+	Notification
+	Comment   Comment
+	Post      Post
+	Commenter User
+}
+
+// NotifyPreference returns how the user wants to hear about kind.
+func (u *User) NotifyPreference(kind string) string {
+	pref := u.NotifyComments
+	if kind == NotificationReply {
+		pref = u.NotifyReplies
+	}
+	if pref == "" {
+		return NotifyInstant
+	}
+	return pref
+}
+
+// SetNotifyPreference changes how the user wants to hear about kind.
+// Unknown preferences are ignored.
+func (u *User) SetNotifyPreference(kind, pref string) {
+	valid := false
+	for _, p := range NotifyChoices {
+		valid = valid || p == pref
+	}
+	if !valid {
+		return
+	}
+	if kind == NotificationReply {
+		u.NotifyReplies = pref
+	} else {
+		u.NotifyComments = pref
+	}
+}
+
+// NotifyComment records the notifications of a new approved comment: one
+// for the author of the post, and one for the author of the comment it
+// replies to. Nobody hears about their own comments.
+func NotifyComment(tx *pop.Connection, comment *Comment) error {
+	// Comments approved again are not news
+	sent, err := tx.Where("comment_id = ?", comment.ID).Count(&Notification{})
+	if err != nil || sent > 0 {
+		return errors.WithStack(err)
+	}
+
+	recipients := map[uuid.UUID]string{}
+	if comment.ParentID.Valid {
+		parent := &Comment{}
+		if err := tx.Find(parent, comment.ParentID.UUID); err == nil {
+			recipients[parent.AuthorID] = NotificationReply
+		}
+	}
+	post := &Post{}
+	if err := tx.Find(post, comment.PostID); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, ok := recipients[post.AuthorID]; !ok {
+		recipients[post.AuthorID] = NotificationComment
+	}
+	delete(recipients, comment.AuthorID)
+
+	for id, kind := range recipients {
+		user := &User{}
+		if err := tx.Find(user, id); err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		pref := user.NotifyPreference(kind)
+		if pref == NotifyOff {
+			continue
+		}
+		n := &Notification{UserID: id, CommentID: comment.ID, Kind: kind, Digest: pref == NotifyDigest}
+		if err := tx.Create(n); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// ClaimInstantNotifications marks the instant notifications waiting to be
+// sent as sent, and returns them. Concurrent workers never claim the same
+// notification.
+func ClaimInstantNotifications(tx *pop.Connection, now time.Time) (Notifications, error) {
+	ns := Notifications{}
+	err := tx.RawQuery("UPDATE notifications SET sent_at = ? WHERE sent_at IS NULL AND digest = false RETURNING *", now).All(&ns)
+	return ns, errors.WithStack(err)
+}
+
+// DigestRecipients returns the users with notifications waiting for a
+// digest, who did not get one within DigestInterval.
+func DigestRecipients(tx *pop.Connection, now time.Time) (Users, error) {
+	users := Users{}
+	err := tx.RawQuery("SELECT * FROM users WHERE (digest_sent_at IS NULL OR digest_sent_at <= ?) AND EXISTS ("+
+		"SELECT 1 FROM notifications WHERE notifications.user_id = users.id AND notifications.sent_at IS NULL AND notifications.digest)",
+		now.Add(-DigestInterval)).All(&users)
+	return users, errors.WithStack(err)
+}
+
+// ClaimDigest marks the notifications waiting for the digest of the user
+// as sent, and returns them.
+func (u *User) ClaimDigest(tx *pop.Connection, now time.Time) (Notifications, error) {
+	ns := Notifications{}
+	err := tx.RawQuery("UPDATE notifications SET sent_at = ? WHERE user_id = ? AND sent_at IS NULL AND digest = true RETURNING *", now, u.ID).All(&ns)
+	if err != nil {
+		return ns, errors.WithStack(err)
+	}
+	u.DigestSentAt = nulls.NewTime(now)
+	err = tx.RawQuery("UPDATE users SET digest_sent_at = ? WHERE id = ?", now, u.ID).Exec()
+	return ns, errors.WithStack(err)
+}
+
+// Release puts notifications that could not be sent back in line.
+func (ns Notifications) Release(tx *pop.Connection) error {
+	for _, n := range ns {
+		if err := tx.RawQuery("UPDATE notifications SET sent_at = NULL WHERE id = ?", n.ID).Exec(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Items loads the comments of the notifications. Notifications of
+// comments deleted or hidden since are left out.
+func (ns Notifications) Items(tx *pop.Connection) ([]NotificationItem, error) {
+	items := []NotificationItem{}
+	for _, n := range ns {
+		item := NotificationItem{Notification: n}
+		if err := tx.Find(&item.Comment, n.CommentID); err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				continue
+			}
+			return items, errors.WithStack(err)
+		}
+		if item.Comment.IsDeleted() || item.Comment.Status != CommentApproved {
+			continue
+		}
+		if err := tx.Find(&item.Post, item.Comment.PostID); err != nil {
+			return items, errors.WithStack(err)
+		}
+		if err := tx.Find(&item.Commenter, item.Comment.AuthorID); err != nil {
+			return items, errors.WithStack(err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
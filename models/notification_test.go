@@ -0,0 +1,72 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_NotifyComment() {
+	newUser := func(name, pref string) *models.User {
+		u := &models.User{Name: name, Email: name + "@example.com", NotifyComments: pref, NotifyReplies: pref}
+		ms.NoError(u.OAuthAndSave(ms.DB))
+		return u
+	}
+	author := newUser("writer", models.NotifyInstant)
+	reader := newUser("reader", models.NotifyDigest)
+	replier := newUser("replier", models.NotifyInstant)
+
+	post := &models.Post{Title: "Noticed", Slug: "noticed", Content: "content", AuthorID: author.ID, Status: models.PostPublished}
+	ms.NoError(ms.DB.Create(post))
+	comment := func(by *models.User, parent *models.Comment) *models.Comment {
+		c := &models.Comment{Content: "hi", AuthorID: by.ID, PostID: post.ID, Status: models.CommentApproved}
+		if parent != nil {
+			c.ParentID = nulls.NewUUID(parent.ID)
+		}
+		ms.NoError(ms.DB.Create(c))
+		ms.NoError(models.NotifyComment(ms.DB, c))
+		return c
+	}
+
+	// The author hears about comments, but not their own
+	own := comment(author, nil)
+	first := comment(reader, nil)
+	comment(replier, first)
+	comment(author, own)
+	ms.NoError(models.NotifyComment(ms.DB, first))
+
+	now := time.Now()
+	instant, err := models.ClaimInstantNotifications(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(instant, 2)
+	for _, n := range instant {
+		ms.Equal(author.ID, n.UserID)
+		ms.Equal(models.NotificationComment, n.Kind)
+	}
+	instant, err = models.ClaimInstantNotifications(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(instant, 0)
+
+	// The reader wants replies in the digest
+	users, err := models.DigestRecipients(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(users, 1)
+	digest, err := users[0].ClaimDigest(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(digest, 1)
+	ms.Equal(models.NotificationReply, digest[0].Kind)
+	items, err := digest.Items(ms.DB)
+	ms.NoError(err)
+	ms.Len(items, 1)
+	ms.Equal(replier.ID, items[0].Commenter.ID)
+
+	// Released notifications are sent again
+	ms.NoError(digest.Release(ms.DB))
+	users, err = models.DigestRecipients(ms.DB, now.Add(models.DigestInterval))
+	ms.NoError(err)
+	ms.Len(users, 1)
+	users, err = models.DigestRecipients(ms.DB, now)
+	ms.NoError(err)
+	ms.Len(users, 0)
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+)
+
+// PasswordResetTTL is how long a password reset link can be used.
+const PasswordResetTTL = time.Hour
+
+// PasswordReset is a single use token sent by email to let a user choose
+// a new password. Only a hash of the token is stored.
+type PasswordReset struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    nulls.Time `json:"used_at" db:"used_at"`
+	Token     string     `json:"-" db:"-"`
+}
+
+// Generate creates a new reset token for the user. The clear token is only
+// available in Token, to be sent to the user.
+func (r *PasswordReset) Generate(tx *pop.Connection, user *User, now time.Time) error {
+	if err := r.newToken(); err != nil {
+		return err
+	}
+	r.UserID = user.ID
+	r.ExpiresAt = now.Add(PasswordResetTTL)
+	return errors.WithStack(tx.Create(r))
+}
+
+// IssueToken replaces the token of the reset, so the clear one is only
+// known where the email is sent. Tokens issued before stop working.
+func (r *PasswordReset) IssueToken(tx *pop.Connection) error {
+	if err := r.newToken(); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.RawQuery("UPDATE password_resets SET token_hash = ? WHERE id = ?", r.TokenHash, r.ID).Exec())
+}
+
+// newToken draws a random token and keeps its hash.
+func (r *PasswordReset) newToken() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return errors.WithStack(err)
+	}
+	r.Token = hex.EncodeToString(b)
+	r.TokenHash = hashToken(r.Token)
+	return nil
+}
+
+// FindPendingPasswordReset finds the unused and unexpired reset with id.
+func FindPendingPasswordReset(tx *pop.Connection, id string, now time.Time) (*PasswordReset, error) {
+	r := &PasswordReset{}
+	err := tx.Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).First(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+// FindPasswordReset finds the unused and unexpired reset matching token.
+func FindPasswordReset(tx *pop.Connection, token string, now time.Time) (*PasswordReset, error) {
+	r := &PasswordReset{}
+	err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), now).First(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+// Redeem changes the password of the user with the same rules as the
+// account page, marks every pending reset of the user as used and ends
+// all their sessions.
+func (r *PasswordReset) Redeem(tx *pop.Connection, password, confirm string, now time.Time) (*validate.Errors, error) {
+	if verrs := ValidatePassword(password, confirm); verrs.HasAny() {
+		return verrs, nil
+	}
+	user := &User{}
+	if err := tx.Find(user, r.UserID); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	if err := user.SetPassword(password); err != nil {
+		return validate.NewErrors(), err
+	}
+	if err := tx.Update(user); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	r.UsedAt = nulls.NewTime(now)
+	err := tx.RawQuery("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, r.UserID).Exec()
+	if err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	// Whoever knew the old password is signed out
+	return validate.NewErrors(), user.RevokeOtherSessions(tx, uuid.Nil, now)
+}
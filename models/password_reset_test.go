@@ -0,0 +1,61 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_PasswordReset_Redeem() {
+	user := &models.User{Name: "Reset", Username: "reset", Email: "reset@example.com", Password: "secret", PasswordConfirm: "secret"}
+	verrs, err := user.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.NoError(ms.DB.Where("email = ?", user.Email).First(user))
+
+	now := time.Now()
+	reset := &models.PasswordReset{}
+	ms.NoError(reset.Generate(ms.DB, user, now))
+	ms.NotEqual(reset.Token, reset.TokenHash)
+
+	_, err = models.FindPasswordReset(ms.DB, reset.Token, now.Add(2*models.PasswordResetTTL))
+	ms.Error(err)
+
+	found, err := models.FindPasswordReset(ms.DB, reset.Token, now)
+	ms.NoError(err)
+
+	verrs, err = found.Redeem(ms.DB, "short", "short", now)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+
+	verrs, err = found.Redeem(ms.DB, "brand new", "brand new", now)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	_, err = models.FindPasswordReset(ms.DB, reset.Token, now)
+	ms.Error(err)
+
+	login := &models.User{Email: user.Email, Password: "brand new"}
+	ms.NoError(login.Authorize(ms.DB))
+}
+
+func (ms *ModelSuite) Test_PasswordReset_IssueToken() {
+	user := &models.User{Name: "Issue", Username: "issue", Email: "issue@example.com", Password: "secret", PasswordConfirm: "secret"}
+	verrs, err := user.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	now := time.Now()
+	reset := &models.PasswordReset{}
+	ms.NoError(reset.Generate(ms.DB, user, now))
+	first := reset.Token
+
+	pending, err := models.FindPendingPasswordReset(ms.DB, reset.ID.String(), now)
+	ms.NoError(err)
+	ms.NoError(pending.IssueToken(ms.DB))
+
+	_, err = models.FindPasswordReset(ms.DB, first, now)
+	ms.Error(err)
+	_, err = models.FindPasswordReset(ms.DB, pending.Token, now)
+	ms.NoError(err)
+}
@@ -0,0 +1,46 @@
+package models
+
+// The policies below answer what a user is allowed to do. They can be
+// called on a nil user, which stands for an anonymous visitor.
+
+// Can reports whether the role of the user grants perm.
+func (u *User) Can(perm Permission) bool {
+	return u != nil && RoleHas(u.Role, perm)
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+// CanEditPost reports whether the user can edit or delete the post.
+// Authors can only change their own posts.
+func (u *User) CanEditPost(p *Post) bool {
+	if u.Can(PermPostEditAny) {
+		return true
+	}
+	return u.Can(PermPostEditOwn) && p.AuthorID == u.ID
+}
+
+// CanSeePost reports whether the user can read the post. Unpublished posts
+// are only shown to the users that can edit them.
+func (u *User) CanSeePost(p *Post) bool {
+	return p.IsPublished() || u.Can(PermPostViewDrafts) || u.CanEditPost(p)
+}
+
+// CanComment reports whether the user can write comments. Users must
+// verify their email before commenting.
+func (u *User) CanComment() bool {
+	return u.Can(PermCommentCreate) && u.IsVerified()
+}
+
+// CanEditComment reports whether the user can edit the comment. Deleted
+// comments are left alone.
+func (u *User) CanEditComment(c *Comment) bool {
+	return u != nil && c.AuthorID == u.ID && !c.IsDeleted()
+}
+
+// CanDeleteComment reports whether the user can delete the comment.
+func (u *User) CanDeleteComment(c *Comment) bool {
+	return u.CanEditComment(c) || (u.Can(PermCommentDeleteAny) && !c.IsDeleted())
+}
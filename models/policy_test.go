@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gobuffalo/uuid"
+)
+
+func Test_User_Policies(t *testing.T) {
+	author := &User{ID: uuid.Must(uuid.NewV4()), Role: RoleAuthor}
+	editor := &User{ID: uuid.Must(uuid.NewV4()), Role: RoleEditor}
+	reader := &User{ID: uuid.Must(uuid.NewV4()), Role: RoleReader}
+	var visitor *User
+
+	own := &Post{AuthorID: author.ID, Status: PostDraft}
+	other := &Post{AuthorID: editor.ID, Status: PostDraft}
+
+	if !author.CanEditPost(own) || author.CanEditPost(other) {
+		t.Fatal("authors should only edit their own posts")
+	}
+	if !editor.CanEditPost(own) || !editor.CanSeePost(own) {
+		t.Fatal("editors should edit and see every post")
+	}
+	if author.CanSeePost(other) || visitor.CanSeePost(own) {
+		t.Fatal("drafts should be hidden from other users")
+	}
+	if reader.Can(PermCommentCreate) || visitor.Can(PermCommentCreate) {
+		t.Fatal("readers and visitors should not comment")
+	}
+
+	comment := &Comment{AuthorID: reader.ID}
+	if !reader.CanDeleteComment(comment) || author.CanDeleteComment(comment) || !editor.CanDeleteComment(comment) {
+		t.Fatal("comments should be deleted by their author or a moderator")
+	}
+	if visitor.IsAdmin() || !(&User{Role: RoleAdmin}).IsAdmin() {
+		t.Fatal("only the admin role should be admin")
+	}
+}
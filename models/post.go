@@ -1,124 +1,262 @@
 package models
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
+	"bytes"
 	"time"
 
 	"github.com/gobuffalo/buffalo/binding"
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
 	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/storage"
 )
 
+// Post statuses. Only published posts are visible to readers, scheduled
+// posts become published once their PublishedAt time has passed.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
+// PostStatuses lists every status a post can be in.
+var PostStatuses = []string{PostDraft, PostScheduled, PostPublished, PostArchived}
+
+// publishAtLayout is the format used by the html datetime-local input.
+const publishAtLayout = "2006-01-02T15:04"
+
 type Post struct {
-	ID        uuid.UUID    `json:"id" db:"id"`
-	CreatedAt time.Time    `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
-	Title     string       `json:"title" db:"title"`
-	FileImage binding.File `db:"-" form:"FileImage"`
-	FileName  string       `json:"file_name" db:"file_name"`
-	Content   string       `json:"content" db:"content"`
-	AuthorID  uuid.UUID    `json:"author_id" db:"author_id"`
-	Tag       string       `json:"-" db:"-"`
+	ID          uuid.UUID    `json:"id" db:"id"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+	Title       string       `json:"title" db:"title"`
+	Slug        string       `json:"slug" db:"slug" form:"-"`
+	FileImage   binding.File `json:"-" db:"-" form:"FileImage"`
+	FileName    string       `json:"file_name" db:"file_name"`
+	Content     string       `json:"content" db:"content"`
+	AuthorID    uuid.UUID    `json:"author_id" db:"author_id"`
+	Status      string       `json:"status" db:"status"`
+	PublishedAt nulls.Time   `json:"published_at" db:"published_at" form:"-"`
+	PublishAt   string       `json:"-" db:"-" form:"PublishAt"`
+
+	// Rejections explain why the uploaded images were refused.
+	Rejections []*UploadRejection `json:"-" db:"-" form:"-"`
 }
 
 type Posts []Post
 
-// Generate a MD5 Hash from a string
-func GetMD5Hash(text string) string {
-	hasher := md5.New()
-	hasher.Write([]byte(text))
-	return hex.EncodeToString(hasher.Sum(nil))
+// PublishedPosts is a pop scope that only keeps published posts.
+func PublishedPosts(q *pop.Query) *pop.Query {
+	return q.Where("posts.status = ?", PostPublished)
 }
 
-// Copy a file to disk
-func CopyToDisk(file binding.File, filename, ext string) error {
-	// Creates uploads folder if it isnt exists yet
-	dir := filepath.Join(".", "public", "uploads")
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+// PublishDuePosts publishes every scheduled post whose publication time
+// is before now.
+func PublishDuePosts(tx *pop.Connection, now time.Time) error {
+	err := tx.RawQuery(
+		"UPDATE posts SET status = ?, updated_at = ? WHERE status = ? AND published_at <= ?",
+		PostPublished, now, PostScheduled, now,
+	).Exec()
+	return errors.WithStack(err)
+}
+
+// IsPublished reports whether the post is visible to everyone.
+func (p Post) IsPublished() bool {
+	return p.Status == PostPublished
+}
+
+// PublishAtValue formats the publication time for the html form.
+func (p Post) PublishAtValue() string {
+	if p.PublishAt != "" {
+		return p.PublishAt
 	}
-	// Copy file to uploads folder
-	f, err := os.Create(filepath.Join(dir, filename))
-	if err != nil {
-		return err
+	if !p.PublishedAt.Valid {
+		return ""
 	}
-	defer f.Close()
-	if _, err = io.Copy(f, file); err != nil {
-		return err
+	return p.PublishedAt.Time.Local().Format(publishAtLayout)
+}
+
+// applyStatus parses the publication time sent by the form and makes sure
+// it agrees with the post status.
+func (p *Post) applyStatus(now time.Time) *validate.Errors {
+	verrs := validate.NewErrors()
+	if p.Status == "" {
+		p.Status = PostDraft
+	}
+	if p.PublishAt != "" {
+		t, err := time.ParseInLocation(publishAtLayout, p.PublishAt, time.Local)
+		if err != nil {
+			verrs.Add("PublishAt", "Publication date is not valid.")
+			return verrs
+		}
+		p.PublishedAt = nulls.NewTime(t)
 	}
-	return nil
+
+	switch p.Status {
+	case PostScheduled:
+		if !p.PublishedAt.Valid || !p.PublishedAt.Time.After(now) {
+			verrs.Add("PublishAt", "Scheduled posts need a publication date in the future.")
+		}
+	case PostPublished:
+		if !p.PublishedAt.Valid || p.PublishedAt.Time.After(now) {
+			p.PublishedAt = nulls.NewTime(now)
+		}
+	}
+	return verrs
+}
+
+// fileExists reports whether an uploaded file is still in the storage
+func fileExists(filename string) bool {
+	ok, err := storage.Default.Exists(filename)
+	return err == nil && ok
 }
 
 //  Upload file to Disk and create a new post
-func (p *Post) UploadAndCreate(tx *pop.Connection) (*validate.Errors, error) {
-	// Check if a file was selected and is a valid file
-	fExt := filepath.Ext(p.FileImage.Filename)
-	exts := map[string]bool{".png": true, ".jpg": true, ".jpeg": true}
-	if _, ok := exts[fExt]; !ok || p.FileImage.Filename == "" {
-		verrs := validate.NewErrors()
-		verrs.Add("FileImage", "Invalid selected file")
+func (p *Post) UploadAndCreate(tx *pop.Connection, limits UploadLimits) (*validate.Errors, error) {
+	// Check the post status before touching the disk
+	if verrs := p.applyStatus(time.Now()); verrs.HasAny() {
 		return verrs, nil
 	}
 
-	// Get files hashed name
-	p.FileName = fmt.Sprint(GetMD5Hash(p.FileImage.Filename), fExt)
-
-	// Try to copy the file
-	if err := CopyToDisk(p.FileImage, p.FileName, fExt); err != nil {
-		return validate.NewErrors(), errors.WithStack(err)
+	// Check and store the image, which new posts need
+	if verrs, err := p.storeImage(tx, limits); err != nil || verrs.HasAny() {
+		return verrs, err
 	}
 
-	// Save post into the DB
-	return tx.ValidateAndCreate(p)
+	// Save post into the DB, the image starts its gallery
+	verrs, err := p.Create(tx)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	_, err = p.attach(tx, p.FileName)
+	return verrs, err
 }
 
 //  Upload file to Disk and update the users post
-func (p *Post) UploadAndUpdated(tx *pop.Connection) (*validate.Errors, error) {
-	// Check if a file was selected
-	fExt := filepath.Ext(p.FileImage.Filename)
-	if p.FileImage.Filename != "" {
-		exts := map[string]bool{".png": true, ".jpg": true, ".jpeg": true}
-		// Check if the file extension is valid
-		if _, ok := exts[fExt]; !ok {
-			verrs := validate.NewErrors()
-			verrs.Add("FileImage", "Invalid selected file")
-			return verrs, nil
+func (p *Post) UploadAndUpdated(tx *pop.Connection, limits UploadLimits) (*validate.Errors, error) {
+	// Check the post status before touching the disk
+	if verrs := p.applyStatus(time.Now()); verrs.HasAny() {
+		return verrs, nil
+	}
+
+	// Check and store the image if a new one was selected
+	uploaded := fileSent(p.FileImage)
+	if uploaded {
+		if verrs, err := p.storeImage(tx, limits); err != nil || verrs.HasAny() {
+			return verrs, err
 		}
-		// Get files hashed name
-		p.FileName = fmt.Sprint(GetMD5Hash(p.FileImage.Filename), fExt)
-		// Try to copy the file
-		if err := CopyToDisk(p.FileImage, p.FileName, fExt); err != nil {
-			return validate.NewErrors(), errors.WithStack(err)
+	}
+
+	verrs, err := p.Update(tx)
+	if err != nil || verrs.HasAny() || !uploaded {
+		return verrs, err
+	}
+	// The new image joins the gallery as its cover
+	_, err = p.attach(tx, p.FileName)
+	return verrs, err
+}
+
+// storeImage checks the uploaded FileImage against limits and stores it
+// under the hash of its content. Refused images are kept in Rejections.
+func (p *Post) storeImage(tx *pop.Connection, limits UploadLimits) (*validate.Errors, error) {
+	verrs := validate.NewErrors()
+	content, ext, rejection, err := limits.CheckImage(p.FileImage)
+	if err != nil {
+		return verrs, err
+	}
+	if rejection != nil {
+		// Only the files actually sent are worth recording
+		if fileSent(p.FileImage) {
+			rejection.UserID = nulls.NewUUID(p.AuthorID)
+			p.Rejections = append(p.Rejections, rejection)
 		}
+		verrs.Add("FileImage", rejection.Reason)
+		return verrs, nil
+	}
+	u, err := StoreUpload(tx, bytes.NewReader(content), ext)
+	if err != nil {
+		return verrs, errors.WithStack(err)
 	}
+	p.FileName = u.Key
+	return verrs, nil
+}
 
-	// Just update the users post without change the file image
-	return tx.ValidateAndUpdate(p)
+// Create saves a new post without image, giving it a status and a url.
+func (p *Post) Create(tx *pop.Connection) (*validate.Errors, error) {
+	if verrs := p.applyStatus(time.Now()); verrs.HasAny() {
+		return verrs, nil
+	}
+	// Give the post a unique url
+	if err := p.generateSlug(tx); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	verrs, err := tx.ValidateAndCreate(p)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	return p.acquireFile(tx, "")
 }
 
-//  Upload file to Disk and create a new post
+// Update saves the changes made to a post.
+func (p *Post) Update(tx *pop.Connection) (*validate.Errors, error) {
+	if verrs := p.applyStatus(time.Now()); verrs.HasAny() {
+		return verrs, nil
+	}
+	// Renamed posts get a new url
+	if err := p.syncSlug(tx); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	// The image stored before the update, to move its reference
+	stored := &Post{}
+	if err := tx.RawQuery("SELECT file_name FROM posts WHERE id = ?", p.ID).First(stored); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	verrs, err := tx.ValidateAndUpdate(p)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	verrs, err = p.acquireFile(tx, stored.FileName)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	return verrs, p.syncCover(tx)
+}
+
+// acquireFile moves the reference of the post from the upload previous to
+// its current image.
+func (p *Post) acquireFile(tx *pop.Connection, previous string) (*validate.Errors, error) {
+	verrs := validate.NewErrors()
+	if p.FileName == previous {
+		return verrs, nil
+	}
+	if err := AcquireUpload(tx, p.FileName); err != nil {
+		if err == ErrUnknownUpload {
+			verrs.Add("FileName", "The image is not stored anymore.")
+			return verrs, nil
+		}
+		return verrs, err
+	}
+	return verrs, ReleaseUpload(tx, previous)
+}
+
+// DeleteFile releases the image and the gallery of a deleted post. The
+// files themselves are removed by CollectUploads once no other post uses
+// them.
 func (p *Post) DeleteFile(tx *pop.Connection) error {
-	// Query all posts that have that filename
-	ct, err := tx.Where("file_name = ?", p.FileName).Count(Post{})
+	list, err := p.Attachments(tx)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	// If there are only a single post using that image it can be removed from disk
-	if ct == 0 {
-		dir := filepath.Join(".", "public", "uploads", p.FileName)
-		if err = os.Remove(dir); err != nil {
-			return errors.WithStack(err)
+	for i := range list {
+		if err := list[i].remove(tx); err != nil {
+			return err
 		}
 	}
-	return nil
+	return ReleaseUpload(tx, p.FileName)
 }
 
 // Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidadeAndCreate, pop.ValidateAndUpdate) method.
@@ -126,5 +264,6 @@ func (p *Post) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.Validate(
 		&validators.StringIsPresent{Field: p.Title, Name: "Title"},
 		&validators.StringIsPresent{Field: p.Content, Name: "Content"},
+		&validators.StringInclusion{Field: p.Status, Name: "Status", List: PostStatuses},
 	), nil
 }
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
+)
+
+// PostRevision is a snapshot of a post taken every time it is saved.
+type PostRevision struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PostID    uuid.UUID `json:"post_id" db:"post_id"`
+	AuthorID  uuid.UUID `json:"author_id" db:"author_id"`
+	Title     string    `json:"title" db:"title"`
+	Content   string    `json:"content" db:"content"`
+	FileName  string    `json:"file_name" db:"file_name"`
+	Status    string    `json:"status" db:"status"`
+	Author    User      `json:"-" db:"-"`
+}
+
+type PostRevisions []PostRevision
+
+// Revise stores a snapshot of the post made by the given author.
+func (p *Post) Revise(tx *pop.Connection, authorID uuid.UUID) error {
+	rev := &PostRevision{
+		PostID:   p.ID,
+		AuthorID: authorID,
+		Title:    p.Title,
+		Content:  p.Content,
+		FileName: p.FileName,
+		Status:   p.Status,
+	}
+	return errors.WithStack(tx.Create(rev))
+}
+
+// Restore copies the revision back into the post and saves it as a new
+// revision authored by authorID. The image is only restored if it is still
+// stored, back in the gallery when it was removed from it.
+func (r *PostRevision) Restore(tx *pop.Connection, p *Post, authorID uuid.UUID) (*validate.Errors, error) {
+	p.Title = r.Title
+	p.Content = r.Content
+	if r.FileName != "" {
+		ok, err := UploadExists(tx, r.FileName)
+		if err != nil {
+			return validate.NewErrors(), err
+		}
+		if ok && fileExists(r.FileName) {
+			p.FileName = r.FileName
+		}
+	}
+	verrs, err := p.Update(tx)
+	if err != nil || verrs.HasAny() {
+		return verrs, err
+	}
+	if p.FileName != "" {
+		if _, err := p.attach(tx, p.FileName); err != nil {
+			return verrs, err
+		}
+	}
+	return verrs, p.Revise(tx, authorID)
+}
+
+// Diff kinds used by DiffLine.
+const (
+	DiffSame    = "same"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// DiffLine is a single line of a line based diff.
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+// Prefix returns the unified diff marker for the line.
+func (d DiffLine) Prefix() string {
+	switch d.Kind {
+	case DiffAdded:
+		return "+"
+	case DiffRemoved:
+		return "-"
+	}
+	return " "
+}
+
+// DiffLines computes a line diff turning a into b, using the longest
+// common subsequence of both texts.
+func DiffLines(a, b string) []DiffLine {
+	al := splitLines(a)
+	bl := splitLines(b)
+
+	// lcs[i][j] holds the length of the LCS of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []DiffLine{}
+	i, j := 0, 0
+	for i < len(al) && j < len(bl) {
+		switch {
+		case al[i] == bl[j]:
+			lines = append(lines, DiffLine{Kind: DiffSame, Text: al[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Kind: DiffRemoved, Text: al[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Kind: DiffAdded, Text: bl[j]})
+			j++
+		}
+	}
+	for ; i < len(al); i++ {
+		lines = append(lines, DiffLine{Kind: DiffRemoved, Text: al[i]})
+	}
+	for ; j < len(bl); j++ {
+		lines = append(lines, DiffLine{Kind: DiffAdded, Text: bl[j]})
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+}
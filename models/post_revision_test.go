@@ -0,0 +1,25 @@
+package models
+
+import "testing"
+
+func Test_DiffLines(t *testing.T) {
+	lines := DiffLines("a\nb\nc", "a\nc\nd")
+	expected := []DiffLine{
+		{Kind: DiffSame, Text: "a"},
+		{Kind: DiffRemoved, Text: "b"},
+		{Kind: DiffSame, Text: "c"},
+		{Kind: DiffAdded, Text: "d"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("line %d: expected %v, got %v", i, expected[i], lines[i])
+		}
+	}
+
+	if lines := DiffLines("", "new"); len(lines) != 1 || lines[0].Kind != DiffAdded {
+		t.Fatalf("expected a single added line, got %v", lines)
+	}
+}
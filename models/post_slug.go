@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxSlugLength keeps generated slugs readable in urls.
+const maxSlugLength = 80
+
+// PostSlug keeps the slugs a post used before being renamed, so old urls
+// keep working.
+type PostSlug struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	PostID    uuid.UUID `json:"post_id" db:"post_id"`
+	Slug      string    `json:"slug" db:"slug"`
+}
+
+type PostSlugs []PostSlug
+
+// Slugify turns a title into a lower case, dash separated url segment.
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Drop the accents left by the decomposition
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	if slug == "" {
+		return "post"
+	}
+	return slug
+}
+
+// generateSlug gives the post a unique slug based on its title, adding a
+// numeric suffix when the slug is already taken by another post.
+func (p *Post) generateSlug(tx *pop.Connection) error {
+	base := Slugify(p.Title)
+	slug := base
+	for n := 2; ; n++ {
+		taken, err := slugTaken(tx, slug, p.ID)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			p.Slug = slug
+			return nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// syncSlug regenerates the slug of a renamed post, keeping the previous
+// slug in the history so it keeps redirecting to the post.
+func (p *Post) syncSlug(tx *pop.Connection) error {
+	base := Slugify(p.Title)
+	if p.Slug == base {
+		return nil
+	}
+	// A suffix is only kept while another post holds the base slug, a
+	// post titled "Top 10" renamed "Top" gets "top" rather than "top-10"
+	if slugMatches(p.Slug, base) {
+		taken, err := slugTaken(tx, base, p.ID)
+		if err != nil || taken {
+			return err
+		}
+	}
+	old := p.Slug
+	if err := p.generateSlug(tx); err != nil {
+		return err
+	}
+	// A post going back to a previous slug no longer needs its redirect
+	if err := tx.RawQuery("DELETE FROM post_slugs WHERE slug = ?", p.Slug).Exec(); err != nil {
+		return errors.WithStack(err)
+	}
+	if old == "" || old == p.Slug {
+		return nil
+	}
+	return errors.WithStack(tx.Create(&PostSlug{PostID: p.ID, Slug: old}))
+}
+
+// RegenerateSlugs gives a title based slug to the posts that were still
+// addressed by their id.
+func RegenerateSlugs(tx *pop.Connection) error {
+	posts := Posts{}
+	if err := tx.Where("slug = CAST(id AS text) OR slug = ''").All(&posts); err != nil {
+		return errors.WithStack(err)
+	}
+	for i := range posts {
+		if err := posts[i].syncSlug(tx); err != nil {
+			return err
+		}
+		if err := tx.Update(&posts[i]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// FindPostBySlug finds the post addressed by slug, which can be its
+// current slug, one of its old slugs or its id. canonical is false when the
+// post should be redirected to its current slug.
+func FindPostBySlug(tx *pop.Connection, slug string) (post *Post, canonical bool, err error) {
+	post = &Post{}
+	err = tx.Where("slug = ?", slug).First(post)
+	if err == nil {
+		return post, true, nil
+	}
+	if errors.Cause(err) != sql.ErrNoRows {
+		return nil, false, errors.WithStack(err)
+	}
+
+	// Old urls used the post id
+	if id, err := uuid.FromString(slug); err == nil {
+		if err := tx.Find(post, id); err != nil {
+			return nil, false, err
+		}
+		return post, false, nil
+	}
+
+	// Renamed posts keep their old slugs
+	old := &PostSlug{}
+	if err := tx.Where("slug = ?", slug).First(old); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Find(post, old.PostID); err != nil {
+		return nil, false, err
+	}
+	return post, false, nil
+}
+
+// slugTaken checks if another post uses, or used to use, the slug.
+func slugTaken(tx *pop.Connection, slug string, postID uuid.UUID) (bool, error) {
+	exists, err := tx.Where("slug = ? AND id != ?", slug, postID).Exists(&Post{})
+	if err != nil || exists {
+		return exists, errors.WithStack(err)
+	}
+	exists, err = tx.Where("slug = ? AND post_id != ?", slug, postID).Exists(&PostSlug{})
+	return exists, errors.WithStack(err)
+}
+
+// slugMatches reports whether slug is base, possibly with a collision suffix.
+func slugMatches(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	if !strings.HasPrefix(slug, base+"-") {
+		return false
+	}
+	// Atoi takes a sign, the suffix is digits only
+	suffix := slug[len(base)+1:]
+	if suffix == "" || suffix[0] < '0' || suffix[0] > '9' {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
@@ -0,0 +1,31 @@
+package models_test
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (ms *ModelSuite) Test_Post_SyncSlug() {
+	create := func(title string) *models.Post {
+		p := &models.Post{Title: title, Content: "content", Status: models.PostDraft}
+		verrs, err := p.Create(ms.DB)
+		ms.NoError(err)
+		ms.False(verrs.HasAny())
+		return p
+	}
+
+	// "top-10" is the slug of "Top 10", not a collision of "top"
+	top10 := create("Top 10")
+	ms.Equal("top-10", top10.Slug)
+	top10.Title = "Top"
+	verrs, err := top10.Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.Equal("top", top10.Slug)
+
+	// A real collision suffix is kept while the base slug is taken
+	other := create("Top")
+	ms.Equal("top-2", other.Slug)
+	other.Content = "edited"
+	verrs, err = other.Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.Equal("top-2", other.Slug)
+}
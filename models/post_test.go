@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+)
+
+func Test_Post_ApplyStatus(t *testing.T) {
+	now := time.Date(2018, 9, 3, 12, 0, 0, 0, time.Local)
+
+	p := &Post{}
+	if verrs := p.applyStatus(now); verrs.HasAny() {
+		t.Fatalf("unexpected errors: %v", verrs)
+	}
+	if p.Status != PostDraft || p.PublishedAt.Valid {
+		t.Fatalf("expected an unpublished draft, got %q %v", p.Status, p.PublishedAt)
+	}
+
+	p = &Post{Status: PostPublished}
+	p.applyStatus(now)
+	if !p.PublishedAt.Valid || !p.PublishedAt.Time.Equal(now) {
+		t.Fatalf("expected published post to be stamped with now, got %v", p.PublishedAt)
+	}
+
+	p = &Post{Status: PostScheduled, PublishAt: "2018-09-01T10:00"}
+	if verrs := p.applyStatus(now); !verrs.HasAny() {
+		t.Fatal("expected a scheduled post in the past to be rejected")
+	}
+
+	p = &Post{Status: PostScheduled, PublishAt: "2018-09-10T10:00"}
+	if verrs := p.applyStatus(now); verrs.HasAny() {
+		t.Fatalf("unexpected errors: %v", verrs)
+	}
+	if p.PublishAtValue() != "2018-09-10T10:00" {
+		t.Fatalf("unexpected publish at value %q", p.PublishAtValue())
+	}
+
+	p = &Post{Status: PostPublished, PublishedAt: nulls.NewTime(now.Add(-time.Hour))}
+	p.applyStatus(now)
+	if !p.PublishedAt.Time.Equal(now.Add(-time.Hour)) {
+		t.Fatal("expected the original publication date to be kept")
+	}
+}
+
+func Test_Slugify(t *testing.T) {
+	table := map[string]string{
+		"Hello World":           "hello-world",
+		"  Écrire en Go!  ":     "ecrire-en-go",
+		"Buffalo & Pop: 2 tips": "buffalo-pop-2-tips",
+		"???":                   "post",
+	}
+	for title, slug := range table {
+		if got := Slugify(title); got != slug {
+			t.Errorf("Slugify(%q) = %q, expected %q", title, got, slug)
+		}
+	}
+
+	if !slugMatches("hello-world-3", "hello-world") || slugMatches("hello-world-x", "hello-world") {
+		t.Error("unexpected slug suffix match")
+	}
+	if !slugMatches("hello-world", "hello-world") || slugMatches("hello-world-+1", "hello-world") || slugMatches("hello-world-", "hello-world") {
+		t.Error("unexpected slug suffix match")
+	}
+}
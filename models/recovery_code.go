@@ -0,0 +1,70 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// recoveryCodeCount is the number of recovery codes given to a user.
+const recoveryCodeCount = 10
+
+// RecoveryCode lets a user log in once without their authenticator app.
+// Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	CodeHash  string     `json:"-" db:"code_hash"`
+	UsedAt    nulls.Time `json:"used_at" db:"used_at"`
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of the user and
+// returns the new ones in clear, to be shown once.
+func GenerateRecoveryCodes(tx *pop.Connection, user *User) ([]string, error) {
+	if err := tx.RawQuery("DELETE FROM recovery_codes WHERE user_id = ?", user.ID).Exec(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		rc := &RecoveryCode{UserID: user.ID, CodeHash: hashToken(code)}
+		if err := tx.Create(rc); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode uses up the unused recovery code of the user matching
+// code, reporting whether there was one.
+func UseRecoveryCode(tx *pop.Connection, user *User, code string, now time.Time) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	rc := &RecoveryCode{}
+	err := tx.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(code)).First(rc)
+	if err != nil {
+		return false, nil
+	}
+	err = tx.RawQuery("UPDATE recovery_codes SET used_at = ? WHERE id = ?", now, rc.ID).Exec()
+	return true, errors.WithStack(err)
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of the
+// user.
+func CountRecoveryCodes(tx *pop.Connection, user *User) (int, error) {
+	n, err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Count(&RecoveryCode{})
+	return n, errors.WithStack(err)
+}
@@ -0,0 +1,61 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_User_TwoFactor() {
+	user := &models.User{Name: "Twofa", Username: "twofa", Email: "twofa@example.com", Password: "secret", PasswordConfirm: "secret"}
+	verrs, err := user.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+
+	now := time.Now()
+	ms.NoError(user.StartTwoFactor(ms.DB))
+	ms.True(user.TwoFactorPending())
+
+	ok, err := user.EnableTwoFactor(ms.DB, "000000x", now)
+	ms.NoError(err)
+	ms.False(ok)
+
+	code, err := models.TOTPCode(user.TOTPSecret, now)
+	ms.NoError(err)
+	ok, err = user.EnableTwoFactor(ms.DB, code, now)
+	ms.NoError(err)
+	ms.True(ok)
+	ms.True(user.HasTwoFactor())
+
+	// A code can't be replayed
+	ok, err = user.VerifySecondFactor(ms.DB, code, now)
+	ms.NoError(err)
+	ms.False(ok)
+
+	codes, err := models.GenerateRecoveryCodes(ms.DB, user)
+	ms.NoError(err)
+	ms.Len(codes, 10)
+
+	ok, err = user.VerifySecondFactor(ms.DB, codes[0], now)
+	ms.NoError(err)
+	ms.True(ok)
+	ok, err = user.VerifySecondFactor(ms.DB, codes[0], now)
+	ms.NoError(err)
+	ms.False(ok)
+
+	left, err := models.CountRecoveryCodes(ms.DB, user)
+	ms.NoError(err)
+	ms.Equal(9, left)
+}
+
+func (ms *ModelSuite) Test_Settings() {
+	on, err := models.SettingOn(ms.DB, models.SettingRequireAdmin2FA)
+	ms.NoError(err)
+	ms.False(on)
+
+	ms.NoError(models.SaveSetting(ms.DB, models.SettingRequireAdmin2FA, "true"))
+	ms.NoError(models.SaveSetting(ms.DB, models.SettingRequireAdmin2FA, "true"))
+	on, err = models.SettingOn(ms.DB, models.SettingRequireAdmin2FA)
+	ms.NoError(err)
+	ms.True(on)
+}
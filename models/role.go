@@ -0,0 +1,62 @@
+package models
+
+// User roles, from the least to the most privileged.
+const (
+	RoleReader    = "reader"
+	RoleCommenter = "commenter"
+	RoleAuthor    = "author"
+	RoleEditor    = "editor"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role a user can have.
+var Roles = []string{RoleReader, RoleCommenter, RoleAuthor, RoleEditor, RoleAdmin}
+
+// Permission is something a role allows its users to do.
+type Permission string
+
+// Permissions checked by the policies and handlers.
+const (
+	PermCommentCreate    Permission = "comments.create"
+	PermCommentDeleteAny Permission = "comments.delete_any"
+	PermCommentModerate  Permission = "comments.moderate"
+	PermPostCreate       Permission = "posts.create"
+	PermPostEditOwn      Permission = "posts.edit_own"
+	PermPostEditAny      Permission = "posts.edit_any"
+	PermPostViewDrafts   Permission = "posts.view_drafts"
+	PermTagManage        Permission = "tags.manage"
+	PermUserManage       Permission = "users.manage"
+)
+
+// rolePermissions is the permission matrix of the roles.
+var rolePermissions = map[string][]Permission{
+	RoleReader: {},
+	RoleCommenter: {
+		PermCommentCreate,
+	},
+	RoleAuthor: {
+		PermCommentCreate,
+		PermPostCreate, PermPostEditOwn,
+	},
+	RoleEditor: {
+		PermCommentCreate, PermCommentDeleteAny, PermCommentModerate,
+		PermPostCreate, PermPostEditOwn, PermPostEditAny, PermPostViewDrafts,
+		PermTagManage,
+	},
+	RoleAdmin: {
+		PermCommentCreate, PermCommentDeleteAny, PermCommentModerate,
+		PermPostCreate, PermPostEditOwn, PermPostEditAny, PermPostViewDrafts,
+		PermTagManage,
+		PermUserManage,
+	},
+}
+
+// RoleHas reports whether role grants perm.
+func RoleHas(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// Markers wrapped around the matched words of a snippet. They are turned
+// into <mark> tags once the snippet has been escaped.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// snippetRadius is the number of characters kept around a match by the
+// LIKE based search.
+const snippetRadius = 120
+
+// postColumns are the posts columns read by the search queries.
+const postColumns = "posts.id, posts.created_at, posts.updated_at, posts.title, posts.slug, posts.file_name, posts.content, posts.author_id, posts.status, posts.published_at"
+
+// postSearchVector computes the search vector of the posts table, it must
+// match the posts_search_vector_update trigger.
+const postSearchVector = "setweight(to_tsvector('pg_catalog.english', coalesce(title, '')), 'A') || setweight(to_tsvector('pg_catalog.english', coalesce(content, '')), 'B')"
+
+// SearchResult is a post matching a search, with its rank and a snippet of
+// the matching content.
+type SearchResult struct {
+	Post
+	Rank    float64 `json:"rank" db:"rank"`
+	Snippet string  `json:"snippet" db:"snippet"`
+}
+
+type SearchResults []SearchResult
+
+// Highlight escapes the snippet and marks the matched words.
+func (s SearchResult) Highlight() template.HTML {
+	h := html.EscapeString(s.Snippet)
+	h = strings.Replace(h, highlightStart, "<mark>", -1)
+	h = strings.Replace(h, highlightStop, "</mark>", -1)
+	return template.HTML(h)
+}
+
+// SearchPosts finds the posts matching term, best matches first. Posts are
+// matched by their title, content and comments. On PostgreSQL the tsvector
+// columns are used, other dialects fall back to a LIKE search.
+func SearchPosts(tx *pop.Connection, term string, includeDrafts bool, params pop.PaginationParams) (SearchResults, *pop.Paginator, error) {
+	var sql string
+	var args []interface{}
+	if tx.Dialect.Name() == "postgres" {
+		sql, args = fullTextQuery(term, includeDrafts)
+	} else {
+		sql, args = likeQuery(term, includeDrafts)
+	}
+
+	// Raw queries aren't paginated by pop, the page is cut in SQL and the
+	// matches are counted on their own
+	paginator := pop.NewPaginatorFromParams(params)
+	total, err := tx.RawQuery(sql, args...).Count(&SearchResult{})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	results := SearchResults{}
+	page := append(args, paginator.PerPage, paginator.Offset)
+	if err := tx.RawQuery(sql+" LIMIT ? OFFSET ?", page...).All(&results); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	paginator.TotalEntriesSize = total
+	paginator.CurrentEntriesSize = len(results)
+	paginator.TotalPages = (total + paginator.PerPage - 1) / paginator.PerPage
+
+	// The LIKE search can't build snippets in SQL
+	if tx.Dialect.Name() != "postgres" {
+		for i := range results {
+			results[i].Snippet = likeSnippet(results[i].Content, term)
+		}
+	}
+	return results, paginator, nil
+}
+
+// RebuildSearchIndex recomputes the search vectors of every post and comment.
+func RebuildSearchIndex(tx *pop.Connection) error {
+	if err := tx.RawQuery("UPDATE posts SET search_vector = " + postSearchVector).Exec(); err != nil {
+		return errors.WithStack(err)
+	}
+	err := tx.RawQuery("UPDATE comments SET search_vector = to_tsvector('pg_catalog.english', coalesce(content, ''))").Exec()
+	return errors.WithStack(err)
+}
+
+func fullTextQuery(term string, includeDrafts bool) (string, []interface{}) {
+	options := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=35, MinWords=15", highlightStart, highlightStop)
+	args := []interface{}{options, term}
+	sql := "SELECT " + postColumns + ", ts_rank(posts.search_vector, query) AS rank, " +
+		"ts_headline('pg_catalog.english', posts.content, query, ?) AS snippet " +
+		"FROM posts, plainto_tsquery('pg_catalog.english', ?) query " +
+		"WHERE (posts.search_vector @@ query OR EXISTS (" +
+		"SELECT 1 FROM comments WHERE comments.post_id = posts.id AND comments.status = '" + CommentApproved + "' " +
+		"AND comments.search_vector @@ query))"
+	if !includeDrafts {
+		sql += " AND posts.status = ?"
+		args = append(args, PostPublished)
+	}
+	sql += " ORDER BY rank DESC, COALESCE(posts.published_at, posts.created_at) DESC"
+	return sql, args
+}
+
+func likeQuery(term string, includeDrafts bool) (string, []interface{}) {
+	like := "%" + strings.ToLower(term) + "%"
+	args := []interface{}{like, like, like}
+	sql := "SELECT " + postColumns + ", 0 AS rank, '' AS snippet FROM posts " +
+		"WHERE (LOWER(posts.title) LIKE ? OR LOWER(posts.content) LIKE ? OR EXISTS (" +
+		"SELECT 1 FROM comments WHERE comments.post_id = posts.id AND comments.status = '" + CommentApproved + "' " +
+		"AND LOWER(comments.content) LIKE ?))"
+	if !includeDrafts {
+		sql += " AND posts.status = ?"
+		args = append(args, PostPublished)
+	}
+	sql += " ORDER BY COALESCE(posts.published_at, posts.created_at) DESC"
+	return sql, args
+}
+
+// likeSnippet cuts the content around the first match of term and marks it.
+func likeSnippet(content, term string) string {
+	i := strings.Index(strings.ToLower(content), strings.ToLower(term))
+	if i < 0 || term == "" {
+		if len(content) > 2*snippetRadius {
+			return content[:runeStart(content, 2*snippetRadius)] + "..."
+		}
+		return content
+	}
+	start, end := i-snippetRadius, i+len(term)+snippetRadius
+	prefix, suffix := "...", "..."
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(content) {
+		end, suffix = len(content), ""
+	}
+	start, end = runeStart(content, start), runeStart(content, end)
+	return prefix + content[start:i] + highlightStart + content[i:i+len(term)] + highlightStop + content[i+len(term):end] + suffix
+}
+
+// runeStart moves i back to the beginning of the utf8 character it is in.
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
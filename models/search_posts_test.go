@@ -0,0 +1,35 @@
+package models_test
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_SearchPosts_Paginates() {
+	author := &models.User{Name: "searcher", Email: "searcher@example.com"}
+	ms.NoError(author.OAuthAndSave(ms.DB))
+	for i := 0; i < 5; i++ {
+		post := &models.Post{
+			Title:    fmt.Sprintf("Bison %d", i),
+			Slug:     fmt.Sprintf("bison-%d", i),
+			Content:  "All about bison.",
+			AuthorID: author.ID,
+			Status:   models.PostPublished,
+		}
+		ms.NoError(ms.DB.Create(post))
+	}
+
+	params := url.Values{"per_page": {"2"}, "page": {"3"}}
+	results, paginator, err := models.SearchPosts(ms.DB, "bison", false, params)
+	ms.NoError(err)
+	ms.Len(results, 1)
+	ms.Equal(5, paginator.TotalEntriesSize)
+	ms.Equal(3, paginator.TotalPages)
+
+	params.Set("page", "1")
+	results, _, err = models.SearchPosts(ms.DB, "bison", false, params)
+	ms.NoError(err)
+	ms.Len(results, 2)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_SearchResult_Highlight(t *testing.T) {
+	res := SearchResult{Snippet: "<b>go</b> and " + highlightStart + "buffalo" + highlightStop}
+	expected := "&lt;b&gt;go&lt;/b&gt; and <mark>buffalo</mark>"
+	if got := string(res.Highlight()); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func Test_LikeSnippet(t *testing.T) {
+	content := strings.Repeat("a", 200) + " Buffalo " + strings.Repeat("b", 200)
+	snippet := likeSnippet(content, "buffalo")
+	if !strings.Contains(snippet, highlightStart+"Buffalo"+highlightStop) {
+		t.Fatalf("expected the match to be marked in %q", snippet)
+	}
+	if !strings.HasPrefix(snippet, "...") || !strings.HasSuffix(snippet, "...") {
+		t.Fatalf("expected the snippet to be cut on both sides, got %q", snippet)
+	}
+
+	if snippet := likeSnippet("short text", "missing"); snippet != "short text" {
+		t.Fatalf("unexpected snippet %q", snippet)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Session is a login of a user on a device. The session cookie only
+// refers to it, so it can be revoked from the server.
+type Session struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	IP         string     `json:"ip" db:"ip"`
+	UserAgent  string     `json:"user_agent" db:"user_agent"`
+	Device     string     `json:"device" db:"device"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt  nulls.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+type Sessions []Session
+
+// StartSession records a new login of the user.
+func StartSession(tx *pop.Connection, user *User, ip, userAgent string, now time.Time) (*Session, error) {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	s := &Session{
+		UserID:     user.ID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		Device:     DeviceName(userAgent),
+		LastSeenAt: now,
+	}
+	return s, errors.WithStack(tx.Create(s))
+}
+
+// FindActiveSession finds the session of the user that was not revoked.
+func FindActiveSession(tx *pop.Connection, userID, id interface{}) (*Session, error) {
+	s := &Session{}
+	err := tx.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).First(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s, nil
+}
+
+// Touch records the activity of the session.
+func (s *Session) Touch(tx *pop.Connection, now time.Time) error {
+	if now.Sub(s.LastSeenAt) < touchInterval {
+		return nil
+	}
+	s.LastSeenAt = now
+	err := tx.RawQuery("UPDATE sessions SET last_seen_at = ? WHERE id = ?", now, s.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// ActiveSessions returns the sessions of the user that were not revoked,
+// the most recently used first.
+func (u *User) ActiveSessions(tx *pop.Connection) (Sessions, error) {
+	sessions := Sessions{}
+	err := tx.Where("user_id = ? AND revoked_at IS NULL", u.ID).Order("last_seen_at desc").All(&sessions)
+	return sessions, errors.WithStack(err)
+}
+
+// RevokeSession ends one session of the user.
+func (u *User) RevokeSession(tx *pop.Connection, id string, now time.Time) error {
+	err := tx.RawQuery("UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", now, id, u.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// RevokeOtherSessions ends every session of the user but keep, which can
+// be uuid.Nil to end them all.
+func (u *User) RevokeOtherSessions(tx *pop.Connection, keep uuid.UUID, now time.Time) error {
+	err := tx.RawQuery("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL", now, u.ID, keep).Exec()
+	return errors.WithStack(err)
+}
+
+// DeviceName sums up a user agent as a browser and a system, like
+// "Firefox on Linux".
+func DeviceName(userAgent string) string {
+	browser := firstMatch(userAgent, "Unknown browser", [][2]string{
+		{"Edge/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Chrome/", "Chrome"},
+		{"Firefox/", "Firefox"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	})
+	system := firstMatch(userAgent, "", [][2]string{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	})
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+// firstMatch returns the name of the first marker found in s.
+func firstMatch(s, def string, markers [][2]string) string {
+	for _, m := range markers {
+		if strings.Contains(s, m[0]) {
+			return m[1]
+		}
+	}
+	return def
+}
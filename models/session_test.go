@@ -0,0 +1,38 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/gobuffalo/uuid"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_Session_Revoke() {
+	user := &models.User{Name: "Roaming", Email: "roaming@example.com"}
+	ms.NoError(user.OAuthAndSave(ms.DB))
+	now := time.Now()
+
+	laptop, err := models.StartSession(ms.DB, user, "10.0.0.1", "Mozilla/5.0 (X11; Linux x86_64) Firefox/62.0", now)
+	ms.NoError(err)
+	ms.Equal("Firefox on Linux", laptop.Device)
+	phone, err := models.StartSession(ms.DB, user, "10.0.0.2", "Mozilla/5.0 (iPhone) Safari/604.1", now)
+	ms.NoError(err)
+	ms.Equal("Safari on iOS", phone.Device)
+	_, err = models.StartSession(ms.DB, user, "10.0.0.3", "curl/7.61.0", now)
+	ms.NoError(err)
+
+	ms.NoError(user.RevokeSession(ms.DB, phone.ID.String(), now))
+	_, err = models.FindActiveSession(ms.DB, user.ID, phone.ID)
+	ms.Error(err)
+
+	ms.NoError(user.RevokeOtherSessions(ms.DB, laptop.ID, now))
+	sessions, err := user.ActiveSessions(ms.DB)
+	ms.NoError(err)
+	ms.Len(sessions, 1)
+	ms.Equal(laptop.ID, sessions[0].ID)
+
+	ms.NoError(user.RevokeOtherSessions(ms.DB, uuid.Nil, now))
+	sessions, err = user.ActiveSessions(ms.DB)
+	ms.NoError(err)
+	ms.Len(sessions, 0)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// Site wide settings changed by admins.
+const (
+	// SettingRequireAdmin2FA makes two-factor authentication mandatory
+	// for admins.
+	SettingRequireAdmin2FA = "require_admin_2fa"
+	// SettingFirstCommentApproval holds the first comment of a user for
+	// moderation.
+	SettingFirstCommentApproval = "first_comment_approval"
+)
+
+// Setting is a site wide option stored as text.
+type Setting struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Key       string    `json:"key" db:"key"`
+	Value     string    `json:"value" db:"value"`
+}
+
+// GetSetting returns the value of the setting key, or def when it was
+// never set.
+func GetSetting(tx *pop.Connection, key, def string) (string, error) {
+	s := &Setting{}
+	if err := tx.Where("key = ?", key).First(s); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return def, nil
+		}
+		return def, errors.WithStack(err)
+	}
+	return s.Value, nil
+}
+
+// SettingOn reports whether the boolean setting key is turned on.
+func SettingOn(tx *pop.Connection, key string) (bool, error) {
+	v, err := GetSetting(tx, key, "false")
+	return v == "true", err
+}
+
+// SaveSetting sets the value of the setting key.
+func SaveSetting(tx *pop.Connection, key, value string) error {
+	s := &Setting{}
+	if err := tx.Where("key = ?", key).First(s); err != nil {
+		if errors.Cause(err) != sql.ErrNoRows {
+			return errors.WithStack(err)
+		}
+		s.Key = key
+	}
+	s.Value = value
+	return errors.WithStack(tx.Save(s))
+}
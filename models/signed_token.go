@@ -0,0 +1,65 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// signingSecret signs the links sent by email.
+var signingSecret = Secret("SIGNING_SECRET", "blogapp-development-signing-secret")
+
+// SignToken returns a token proving that the application vouched for
+// subject, for the given purpose, until expires. Signed tokens need no
+// storage, so they are used for links sent by email.
+func SignToken(purpose, subject string, expires time.Time) string {
+	payload := strings.Join([]string{purpose, subject, strconv.FormatInt(expires.Unix(), 10)}, "|")
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(signature(payload))
+}
+
+// VerifySignedToken checks the signature, purpose and expiry of token and
+// returns its subject.
+func VerifySignedToken(purpose, token string, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errors.New("malformed signed token")
+	}
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	mac, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if !hmac.Equal(mac, signature(string(payload))) {
+		return "", errors.New("invalid token signature")
+	}
+
+	fields := strings.Split(string(payload), "|")
+	if len(fields) != 3 || fields[0] != purpose {
+		return "", errors.New("token signed for another purpose")
+	}
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if now.Unix() >= expires {
+		return "", errors.New("signed token expired")
+	}
+	return fields[1], nil
+}
+
+// signature is the HMAC of payload.
+func signature(payload string) []byte {
+	h := hmac.New(sha256.New, signingSecret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
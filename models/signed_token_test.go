@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SignedToken(t *testing.T) {
+	now := time.Date(2018, 9, 20, 12, 0, 0, 0, time.UTC)
+	token := SignToken("verify", "someone", now.Add(time.Hour))
+
+	subject, err := VerifySignedToken("verify", token, now)
+	if err != nil || subject != "someone" {
+		t.Fatalf("expected the subject back, got %q %v", subject, err)
+	}
+	if _, err := VerifySignedToken("unsubscribe", token, now); err == nil {
+		t.Fatal("a token should only be valid for its purpose")
+	}
+	if _, err := VerifySignedToken("verify", token, now.Add(2*time.Hour)); err == nil {
+		t.Fatal("an expired token should be rejected")
+	}
+	if _, err := VerifySignedToken("verify", token+"x", now); err == nil {
+		t.Fatal("a tampered token should be rejected")
+	}
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// SpamThreshold is the score from which a comment is spam.
+const SpamThreshold = 1.0
+
+// SpamInput is a new comment with what is known of its request.
+type SpamInput struct {
+	Comment   *Comment
+	Author    *User
+	IP        string
+	UserAgent string
+	Referrer  string
+	Permalink string
+	// Honeypot is the value of a form field hidden from people.
+	Honeypot string
+}
+
+// SpamVerdict is the outcome of a spam check. Reason explains a non zero
+// Score to the moderators.
+type SpamVerdict struct {
+	Score  float64
+	Reason string
+}
+
+// IsSpam reports whether the score reaches SpamThreshold.
+func (v SpamVerdict) IsSpam() bool {
+	return v.Score >= SpamThreshold
+}
+
+// SpamChecker scores new comments.
+type SpamChecker interface {
+	Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error)
+}
+
+// SpamCheckers adds up the scores of several checkers. A failing checker
+// does not stop the others, its error is returned with their verdict.
+type SpamCheckers []SpamChecker
+
+// Check runs every checker.
+func (cs SpamCheckers) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	total := SpamVerdict{}
+	reasons := []string{}
+	var failed error
+	for _, c := range cs {
+		v, err := c.Check(tx, in)
+		if err != nil {
+			failed = err
+			continue
+		}
+		if v.Score > 0 {
+			total.Score += v.Score
+			reasons = append(reasons, v.Reason)
+		}
+	}
+	total.Reason = strings.Join(reasons, "; ")
+	return total, failed
+}
+
+// linkPattern matches the links of a comment.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkChecker scores comments with more than Max links, half a point per
+// extra link.
+type LinkChecker struct {
+	Max int
+}
+
+// Check counts the links of the comment.
+func (l LinkChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	n := len(linkPattern.FindAllString(in.Comment.Content, -1))
+	if n <= l.Max {
+		return SpamVerdict{}, nil
+	}
+	return SpamVerdict{Score: 0.5 * float64(n-l.Max), Reason: fmt.Sprintf("%d links", n)}, nil
+}
+
+// BlocklistChecker flags comments containing a blocked word, or a blocked
+// domain in their content or author email.
+type BlocklistChecker struct {
+	Words   []string
+	Domains []string
+}
+
+// Check looks for the blocked words and domains.
+func (b BlocklistChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	content := strings.ToLower(in.Comment.Content)
+	for _, w := range b.Words {
+		if w != "" && strings.Contains(content, strings.ToLower(w)) {
+			return SpamVerdict{Score: SpamThreshold, Reason: fmt.Sprintf("blocked word %q", w)}, nil
+		}
+	}
+	email := ""
+	if in.Author != nil {
+		email = strings.ToLower(in.Author.Email)
+	}
+	for _, d := range b.Domains {
+		d = strings.ToLower(d)
+		if d != "" && (strings.Contains(content, d) || strings.HasSuffix(email, "@"+d)) {
+			return SpamVerdict{Score: SpamThreshold, Reason: fmt.Sprintf("blocked domain %q", d)}, nil
+		}
+	}
+	return SpamVerdict{}, nil
+}
+
+// VelocityChecker flags authors writing Max comments or more within
+// Window.
+type VelocityChecker struct {
+	Max    int
+	Window time.Duration
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// Check counts the recent comments of the author.
+func (v VelocityChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	if in.Author == nil || v.Max <= 0 {
+		return SpamVerdict{}, nil
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	n, err := tx.Where("author_id = ? AND created_at > ?", in.Author.ID, now().Add(-v.Window)).Count(&Comment{})
+	if err != nil {
+		return SpamVerdict{}, errors.WithStack(err)
+	}
+	if n < v.Max {
+		return SpamVerdict{}, nil
+	}
+	return SpamVerdict{Score: SpamThreshold, Reason: fmt.Sprintf("%d comments in %s", n, v.Window)}, nil
+}
+
+// HoneypotChecker flags comments filling the hidden form field, which
+// only bots do.
+type HoneypotChecker struct{}
+
+// Check looks at the hidden field.
+func (HoneypotChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	if in.Honeypot == "" {
+		return SpamVerdict{}, nil
+	}
+	return SpamVerdict{Score: SpamThreshold, Reason: "honeypot field filled"}, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/pop"
+)
+
+type failingChecker struct{}
+
+func (failingChecker) Check(tx *pop.Connection, in SpamInput) (SpamVerdict, error) {
+	return SpamVerdict{}, errors.New("unavailable")
+}
+
+func Test_SpamCheckers(t *testing.T) {
+	checkers := SpamCheckers{
+		HoneypotChecker{},
+		LinkChecker{Max: 1},
+		BlocklistChecker{Words: []string{"Casino"}, Domains: []string{"spam.example"}},
+		failingChecker{},
+	}
+	author := &User{Email: "someone@example.com"}
+
+	v, err := checkers.Check(nil, SpamInput{Comment: &Comment{Content: "Nice post, see www.example.com"}, Author: author})
+	if err == nil {
+		t.Fatal("expected the failing checker error")
+	}
+	if v.IsSpam() || v.Score != 0 {
+		t.Fatalf("expected a clean comment, got %+v", v)
+	}
+
+	// A link with both a scheme and www is still one link
+	v, _ = checkers.Check(nil, SpamInput{Comment: &Comment{Content: "See https://www.example.com"}, Author: author})
+	if v.Score != 0 {
+		t.Fatalf("expected a single link, got %+v", v)
+	}
+
+	v, _ = checkers.Check(nil, SpamInput{Comment: &Comment{Content: "http://a http://b"}, Author: author})
+	if v.IsSpam() || v.Reason != "2 links" {
+		t.Fatalf("expected a suspicious comment, got %+v", v)
+	}
+
+	v, _ = checkers.Check(nil, SpamInput{Comment: &Comment{Content: "http://a http://b http://c"}, Author: author, Honeypot: "x"})
+	if !v.IsSpam() || v.Reason != "honeypot field filled; 3 links" {
+		t.Fatalf("expected spam, got %+v", v)
+	}
+
+	v, _ = checkers.Check(nil, SpamInput{Comment: &Comment{Content: "best casino"}, Author: author})
+	if !v.IsSpam() {
+		t.Fatalf("expected the blocked word to be spam, got %+v", v)
+	}
+	v, _ = checkers.Check(nil, SpamInput{Comment: &Comment{Content: "hi"}, Author: &User{Email: "bot@SPAM.example"}})
+	if !v.IsSpam() {
+		t.Fatalf("expected the blocked domain to be spam, got %+v", v)
+	}
+}
+
+func Test_AkismetChecker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.1/comment-check" || r.FormValue("api_key") != "key" {
+			w.Write([]byte("invalid"))
+			return
+		}
+		if r.FormValue("comment_content") == "buy now" {
+			w.Write([]byte("true"))
+			return
+		}
+		w.Write([]byte("false"))
+	}))
+	defer srv.Close()
+
+	a := NewAkismetChecker("key", "http://blog.example", srv.URL)
+	v, err := a.Check(nil, SpamInput{Comment: &Comment{Content: "buy now"}})
+	if err != nil || !v.IsSpam() {
+		t.Fatalf("expected spam, got %+v %v", v, err)
+	}
+	v, err = a.Check(nil, SpamInput{Comment: &Comment{Content: "thanks"}})
+	if err != nil || v.IsSpam() {
+		t.Fatalf("expected ham, got %+v %v", v, err)
+	}
+
+	a.Key = "wrong"
+	if _, err := a.Check(nil, SpamInput{Comment: &Comment{Content: "thanks"}}); err == nil {
+		t.Fatal("expected an error for an invalid answer")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gobuffalo/pop"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
+	"github.com/pkg/errors"
 )
 
 type TagPost struct {
@@ -23,3 +24,60 @@ func (t *TagPost) TableName() string {
 func (t *TagPost) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
+
+// SyncTags makes the tags of the post match the given tag codes, inserting
+// and deleting tags_posts rows as needed.
+func (p *Post) SyncTags(tx *pop.Connection, codes []int) error {
+	// Find the tags behind the codes
+	tags := Tags{}
+	if len(codes) > 0 {
+		args := make([]interface{}, len(codes))
+		for i, code := range codes {
+			args[i] = code
+		}
+		if err := tx.Where("code IN (?)", args...).All(&tags); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	wanted := map[uuid.UUID]bool{}
+	for _, tag := range tags {
+		wanted[tag.ID] = true
+	}
+
+	// Remove the tags that were unselected
+	existing := TagsPosts{}
+	if err := tx.Where("post_id = ?", p.ID).All(&existing); err != nil {
+		return errors.WithStack(err)
+	}
+	for i := range existing {
+		if wanted[existing[i].TagID] {
+			delete(wanted, existing[i].TagID)
+			continue
+		}
+		if err := tx.Destroy(&existing[i]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// Add the new ones
+	for tagID := range wanted {
+		if err := tx.Create(&TagPost{PostID: p.ID, TagID: tagID}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// TagCodes returns the codes of the tags of the post.
+func (p *Post) TagCodes(tx *pop.Connection) ([]int, error) {
+	tags := Tags{}
+	err := tx.Q().Where("tags.id = tags_posts.tag_id").LeftJoin("tags_posts", "tags_posts.post_id = ?", p.ID).All(&tags)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	codes := make([]int, len(tags))
+	for i, tag := range tags {
+		codes[i] = tag.Code
+	}
+	return codes, nil
+}
@@ -0,0 +1,29 @@
+package models_test
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (ms *ModelSuite) Test_Post_SyncTags() {
+	post := &models.Post{Title: "Tagged", Slug: "tagged", Content: "content", Status: models.PostPublished}
+	ms.NoError(ms.DB.Create(post))
+
+	tags := []*models.Tag{{Name: "go"}, {Name: "buffalo"}, {Name: "pop"}}
+	for _, tag := range tags {
+		ms.NoError(ms.DB.Create(tag))
+		ms.NoError(ms.DB.Reload(tag))
+	}
+
+	ms.NoError(post.SyncTags(ms.DB, []int{tags[0].Code, tags[1].Code}))
+	codes, err := post.TagCodes(ms.DB)
+	ms.NoError(err)
+	ms.ElementsMatch([]int{tags[0].Code, tags[1].Code}, codes)
+
+	ms.NoError(post.SyncTags(ms.DB, []int{tags[1].Code, tags[2].Code}))
+	codes, err = post.TagCodes(ms.DB)
+	ms.NoError(err)
+	ms.ElementsMatch([]int{tags[1].Code, tags[2].Code}, codes)
+
+	ms.NoError(post.SyncTags(ms.DB, []int{}))
+	count, err := ms.DB.Where("post_id = ?", post.ID).Count(&models.TagPost{})
+	ms.NoError(err)
+	ms.Equal(0, count)
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+)
+
+// totpStep is the lifetime in seconds of a TOTP code. With six digit
+// codes and SHA-1 it matches the defaults of authenticator apps.
+const totpStep = 30
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random secret, base32 encoded as
+// authenticator apps expect it.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPCode returns the code of secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return totpCode(secret, t.Unix()/totpStep)
+}
+
+// totpCode computes the HOTP code of secret for the time step counter.
+func totpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", v%1000000), nil
+}
+
+// matchTOTP returns the time step of code around now. One step of clock
+// drift is allowed each way.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.Replace(code, " ", "", -1)
+	step := now.Unix() / totpStep
+	for _, s := range []int64{step - 1, step, step + 1} {
+		want, err := totpCode(secret, s)
+		if err == nil && hmac.Equal([]byte(want), []byte(code)) {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// HasTwoFactor reports whether the user confirmed a TOTP secret.
+func (u *User) HasTwoFactor() bool {
+	return u != nil && u.TOTPEnabledAt.Valid
+}
+
+// TwoFactorPending reports whether the user started enrolling a TOTP
+// secret without confirming it yet.
+func (u *User) TwoFactorPending() bool {
+	return u != nil && u.TOTPSecret != "" && !u.TOTPEnabledAt.Valid
+}
+
+// TOTPURI returns the otpauth URI to add the secret of the user to an
+// authenticator app.
+func (u *User) TOTPURI(issuer string) string {
+	label := url.PathEscape(issuer + ":" + u.Email)
+	q := url.Values{}
+	q.Set("secret", u.TOTPSecret)
+	q.Set("issuer", issuer)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// StartTwoFactor gives the user a new secret to confirm with a code.
+func (u *User) StartTwoFactor(tx *pop.Connection) error {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return err
+	}
+	u.TOTPSecret = secret
+	u.TOTPEnabledAt = nulls.Time{}
+	u.TOTPLastStep = 0
+	err = tx.RawQuery("UPDATE users SET totp_secret = ?, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?", secret, u.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// EnableTwoFactor turns two-factor authentication on if code matches the
+// pending secret.
+func (u *User) EnableTwoFactor(tx *pop.Connection, code string, now time.Time) (bool, error) {
+	if !u.TwoFactorPending() {
+		return false, nil
+	}
+	ok, err := u.checkTOTP(tx, code, now)
+	if err != nil || !ok {
+		return false, err
+	}
+	u.TOTPEnabledAt = nulls.NewTime(now)
+	err = tx.RawQuery("UPDATE users SET totp_enabled_at = ? WHERE id = ?", now, u.ID).Exec()
+	return true, errors.WithStack(err)
+}
+
+// DisableTwoFactor turns two-factor authentication off and drops the
+// recovery codes of the user.
+func (u *User) DisableTwoFactor(tx *pop.Connection) error {
+	u.TOTPSecret = ""
+	u.TOTPEnabledAt = nulls.Time{}
+	err := tx.RawQuery("UPDATE users SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?", u.ID).Exec()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = tx.RawQuery("DELETE FROM recovery_codes WHERE user_id = ?", u.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// VerifySecondFactor checks a TOTP code or, failing that, one of the
+// recovery codes of the user.
+func (u *User) VerifySecondFactor(tx *pop.Connection, code string, now time.Time) (bool, error) {
+	if !u.HasTwoFactor() {
+		return false, nil
+	}
+	ok, err := u.checkTOTP(tx, code, now)
+	if err != nil || ok {
+		return ok, err
+	}
+	return UseRecoveryCode(tx, u, code, now)
+}
+
+// checkTOTP checks code against the secret of the user. A code can't be
+// used twice, so the last matched time step is recorded.
+func (u *User) checkTOTP(tx *pop.Connection, code string, now time.Time) (bool, error) {
+	step, ok := matchTOTP(u.TOTPSecret, code, now)
+	if !ok || step <= u.TOTPLastStep {
+		return false, nil
+	}
+	u.TOTPLastStep = step
+	err := tx.RawQuery("UPDATE users SET totp_last_step = ? WHERE id = ?", step, u.ID).Exec()
+	return true, errors.WithStack(err)
+}
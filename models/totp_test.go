@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("at %d expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func Test_MatchTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now.Add(-totpStep*time.Second))
+	if _, ok := matchTOTP(secret, code, now); !ok {
+		t.Fatal("the previous code should still be accepted")
+	}
+	code, _ = TOTPCode(secret, now.Add(-3*totpStep*time.Second))
+	if _, ok := matchTOTP(secret, code, now); ok {
+		t.Fatal("old codes should be rejected")
+	}
+}
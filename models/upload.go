@@ -0,0 +1,260 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/imaging"
+	"github.com/sampalm/buffalo/blogapp/storage"
+)
+
+// Upload is a file of the storage, named by the hash of its content so
+// identical files are stored once. RefCount counts the posts and the
+// attachments using it, files nothing uses anymore are collected by
+// CollectUploads. Images get resized variants once ProcessUpload ran.
+type Upload struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Key         string     `json:"key" db:"key"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	Size        int64      `json:"size" db:"size"`
+	RefCount    int        `json:"ref_count" db:"ref_count"`
+	Width       int        `json:"width" db:"width"`
+	Height      int        `json:"height" db:"height"`
+	ProcessedAt nulls.Time `json:"processed_at" db:"processed_at"`
+}
+
+type Uploads []Upload
+
+// UploadKey names content by its SHA-256, keeping the extension.
+// Uploads are named by the content sent, before their metadata is
+// stripped.
+func UploadKey(content []byte, ext string) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]) + strings.ToLower(ext)
+}
+
+// StoreUpload saves the content of r upright and without its metadata,
+// unless the same content is already stored, and returns its upload. The
+// upload row stays locked until tx ends, so it can't be collected before
+// the caller references it. The file of a rolled back upload is left to
+// SweepUploads.
+func StoreUpload(tx *pop.Connection, r io.Reader, ext string) (*Upload, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key := UploadKey(content, ext)
+	// Without its metadata the orientation would be lost
+	content, orientation := imaging.Strip(content)
+	if content, err = imaging.Upright(content, orientation); err != nil {
+		return nil, err
+	}
+	u := &Upload{
+		Key:         key,
+		ContentType: mime.TypeByExtension(strings.ToLower(ext)),
+		Size:        int64(len(content)),
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	now := time.Now()
+	err = tx.RawQuery("INSERT INTO uploads (id, key, content_type, size, ref_count, created_at, updated_at) "+
+		"VALUES (?, ?, ?, ?, 0, ?, ?) ON CONFLICT (key) DO NOTHING", id, u.Key, u.ContentType, u.Size, now, now).Exec()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := tx.RawQuery("SELECT * FROM uploads WHERE key = ? FOR UPDATE", u.Key).First(u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// A new upload always writes its file, so the file a rolled back
+	// upload left is written again rather than swept
+	ok := false
+	if u.ID != id {
+		if ok, err = storage.Default.Exists(u.Key); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if !ok {
+		if err := storage.Default.Put(u.Key, bytes.NewReader(content), u.ContentType); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return u, nil
+}
+
+// UploadExists reports whether key names a stored upload.
+func UploadExists(tx *pop.Connection, key string) (bool, error) {
+	n, err := tx.Where("key = ?", key).Count(&Upload{})
+	return n > 0, errors.WithStack(err)
+}
+
+// ErrUnknownUpload is returned when a key names no stored upload.
+var ErrUnknownUpload = errors.New("upload not found")
+
+// AcquireUpload counts a new reference to the upload key. The row is
+// locked first so a running collection can't remove it meanwhile.
+func AcquireUpload(tx *pop.Connection, key string) error {
+	if key == "" {
+		return nil
+	}
+	u := &Upload{}
+	if err := tx.RawQuery("SELECT * FROM uploads WHERE key = ? FOR UPDATE", key).First(u); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrUnknownUpload
+		}
+		return errors.WithStack(err)
+	}
+	err := tx.RawQuery("UPDATE uploads SET ref_count = ref_count + 1 WHERE id = ?", u.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// ReleaseUpload drops a reference to the upload key. The file is only
+// removed later, by CollectUploads, once nothing references it.
+func ReleaseUpload(tx *pop.Connection, key string) error {
+	if key == "" {
+		return nil
+	}
+	err := tx.RawQuery("UPDATE uploads SET ref_count = ref_count - 1 WHERE key = ? AND ref_count > 0", key).Exec()
+	return errors.WithStack(err)
+}
+
+// CollectUploads removes the files no post references and returns how
+// many there were. Uploads locked by a transaction storing them are left
+// for the next collection. The files are only deleted once their rows
+// are, those a failure leaves behind are removed by SweepUploads.
+func CollectUploads(db *pop.Connection) (int, error) {
+	unused := Uploads{}
+	err := db.Transaction(func(tx *pop.Connection) error {
+		if err := tx.RawQuery("SELECT * FROM uploads WHERE ref_count <= 0 FOR UPDATE SKIP LOCKED").All(&unused); err != nil {
+			return errors.WithStack(err)
+		}
+		for i := range unused {
+			if err := tx.Destroy(&unused[i]); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range unused {
+		for _, key := range u.Keys() {
+			if err := storage.Default.Delete(key); err != nil {
+				return 0, errors.WithStack(err)
+			}
+		}
+	}
+	return len(unused), nil
+}
+
+// SweepUploads removes the files stored before t that no upload or post
+// names, like the ones of a rolled back StoreUpload, and returns how many
+// there were. t must leave the transactions still storing files enough
+// time to commit.
+func SweepUploads(db *pop.Connection, before time.Time) (int, error) {
+	stored, err := storage.Default.List(before)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	uploads := Uploads{}
+	if err := db.All(&uploads); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	known := map[string]bool{}
+	for _, u := range uploads {
+		for _, key := range u.Keys() {
+			known[key] = true
+		}
+	}
+	// Files of the posts not rehashed yet are kept too
+	names := []struct {
+		FileName string `db:"file_name"`
+	}{}
+	err = db.RawQuery("SELECT DISTINCT file_name FROM posts WHERE file_name <> '' " +
+		"UNION SELECT DISTINCT file_name FROM post_revisions WHERE file_name <> ''").All(&names)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	for _, n := range names {
+		known[n.FileName] = true
+	}
+
+	swept := 0
+	for _, key := range stored {
+		if known[key] {
+			continue
+		}
+		if err := storage.Default.Delete(key); err != nil {
+			return swept, errors.WithStack(err)
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+// RehashUploads copies the files of the posts named before uploads were
+// content addressed under their hash, and counts the references of every
+// upload, by posts and attachments. It returns the old names, to remove
+// from the storage once tx is committed.
+func RehashUploads(tx *pop.Connection) ([]string, error) {
+	names := []struct {
+		FileName string `db:"file_name"`
+	}{}
+	err := tx.RawQuery("SELECT DISTINCT file_name FROM posts WHERE file_name <> '' " +
+		"UNION SELECT DISTINCT file_name FROM post_revisions WHERE file_name <> ''").All(&names)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	moved := []string{}
+	for _, n := range names {
+		name := n.FileName
+		r, err := storage.Default.Get(name)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return moved, errors.WithStack(err)
+		}
+		u, err := StoreUpload(tx, r, filepath.Ext(name))
+		r.Close()
+		if err != nil {
+			return moved, err
+		}
+		if u.Key == name {
+			continue
+		}
+		for _, q := range []string{
+			"UPDATE posts SET file_name = ? WHERE file_name = ?",
+			"UPDATE post_revisions SET file_name = ? WHERE file_name = ?",
+			"UPDATE attachments SET upload_key = ? WHERE upload_key = ?",
+		} {
+			if err := tx.RawQuery(q, u.Key, name).Exec(); err != nil {
+				return moved, errors.WithStack(err)
+			}
+		}
+		moved = append(moved, name)
+	}
+
+	err = tx.RawQuery("UPDATE uploads SET ref_count = (SELECT count(*) FROM posts WHERE posts.file_name = uploads.key) " +
+		"+ (SELECT count(*) FROM attachments WHERE attachments.upload_key = uploads.key)").Exec()
+	return moved, errors.WithStack(err)
+}
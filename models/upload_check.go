@@ -0,0 +1,124 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo/binding"
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// imageTypes maps the content types accepted as post images to the
+// extension they are stored with.
+var imageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// UploadLimits bounds the images accepted for posts. Zero values disable
+// a limit.
+type UploadLimits struct {
+	// MaxBytes is the largest file size.
+	MaxBytes int64
+	// MaxWidth and MaxHeight bound the size of the image in pixels.
+	MaxWidth  int
+	MaxHeight int
+	// MaxFiles is the most images attached by a single form.
+	MaxFiles int
+}
+
+// fileSent tells whether a file was selected in the form.
+func fileSent(f binding.File) bool {
+	return f.FileHeader != nil && f.File != nil && f.Filename != ""
+}
+
+// UploadRejection records an upload refused by UploadLimits, to keep an
+// eye on what people try to send.
+type UploadRejection struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	UserID      nulls.UUID `json:"user_id" db:"user_id"`
+	IP          string     `json:"ip" db:"ip"`
+	Filename    string     `json:"filename" db:"filename"`
+	Size        int64      `json:"size" db:"size"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	Reason      string     `json:"reason" db:"reason"`
+}
+
+// Record saves the rejection. Pass a connection outside of the request
+// transaction, which is rolled back with the rejected form.
+func (r *UploadRejection) Record(db *pop.Connection) error {
+	return errors.WithStack(db.Create(r))
+}
+
+// CheckImage reads an uploaded image and makes sure it is one, from its
+// content rather than its name. It returns the content and the extension
+// of its real type, or the rejection explaining what is wrong with it.
+func (l UploadLimits) CheckImage(f binding.File) ([]byte, string, *UploadRejection, error) {
+	if !fileSent(f) {
+		return nil, "", &UploadRejection{Reason: "Select an image to upload."}, nil
+	}
+	reject := func(size int64, contentType, reason string) ([]byte, string, *UploadRejection, error) {
+		return nil, "", &UploadRejection{
+			Filename:    f.Filename,
+			Size:        size,
+			ContentType: contentType,
+			Reason:      reason,
+		}, nil
+	}
+
+	// Never read more than one byte past the limit
+	var r io.Reader = f
+	if l.MaxBytes > 0 {
+		r = io.LimitReader(f, l.MaxBytes+1)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", nil, errors.WithStack(err)
+	}
+	size := int64(len(content))
+	if f.Size > size {
+		size = f.Size
+	}
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return reject(size, "", fmt.Sprintf("The image is larger than %s.", formatBytes(l.MaxBytes)))
+	}
+
+	contentType := http.DetectContentType(content)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return reject(size, contentType, "The file is not a PNG or JPEG image.")
+	}
+	// The dimensions are checked before decoding the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return reject(size, contentType, "The image is damaged and could not be read.")
+	}
+	if (l.MaxWidth > 0 && cfg.Width > l.MaxWidth) || (l.MaxHeight > 0 && cfg.Height > l.MaxHeight) {
+		return reject(size, contentType, fmt.Sprintf("The image is larger than %dx%d pixels.", l.MaxWidth, l.MaxHeight))
+	}
+	if _, _, err := image.Decode(bytes.NewReader(content)); err != nil {
+		return reject(size, contentType, "The image is damaged and could not be read.")
+	}
+	return content, ext, nil, nil
+}
+
+// formatBytes writes a size for people.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
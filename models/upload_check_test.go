@@ -0,0 +1,94 @@
+package models
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"testing"
+
+	"github.com/gobuffalo/buffalo/binding"
+)
+
+// memoryFile is an uploaded file held in memory.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// UploadedFile binds content as an uploaded file. It is exported for the
+// tests of the models_test package.
+func UploadedFile(name string, content []byte) binding.File {
+	return binding.File{
+		File:       memoryFile{bytes.NewReader(content)},
+		FileHeader: &multipart.FileHeader{Filename: name, Size: int64(len(content))},
+	}
+}
+
+func Test_UploadLimits_CheckImage(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+	limits := UploadLimits{MaxBytes: 4096, MaxWidth: 100, MaxHeight: 100}
+
+	// The content decides the type, not the name
+	content, ext, rejection, err := limits.CheckImage(UploadedFile("photo.jpg", img))
+	if err != nil || rejection != nil {
+		t.Fatalf("expected the image to pass, got %v %v", rejection, err)
+	}
+	if ext != ".png" || !bytes.Equal(content, img) {
+		t.Fatalf("expected the png content, got %q", ext)
+	}
+
+	truncated := append([]byte{}, img[:len(img)-20]...)
+	cases := []struct {
+		name    string
+		content []byte
+		limits  UploadLimits
+		reason  string
+	}{
+		{"script.jpg", []byte("<script>alert(1)</script>"), limits, "The file is not a PNG or JPEG image."},
+		{"broken.png", truncated, limits, "The image is damaged and could not be read."},
+		{"big.png", img, UploadLimits{MaxBytes: 10}, "The image is larger than 10 bytes."},
+		{"wide.png", img, UploadLimits{MaxWidth: 30, MaxHeight: 30}, "The image is larger than 30x30 pixels."},
+	}
+	for _, tc := range cases {
+		_, _, rejection, err := tc.limits.CheckImage(UploadedFile(tc.name, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rejection == nil || rejection.Reason != tc.reason {
+			t.Fatalf("%s: expected %q, got %v", tc.name, tc.reason, rejection)
+		}
+		if rejection.Filename != tc.name {
+			t.Fatalf("%s: expected the file name in the rejection, got %q", tc.name, rejection.Filename)
+		}
+	}
+
+	if _, _, rejection, _ := limits.CheckImage(binding.File{}); rejection == nil {
+		t.Fatal("expected a missing file to be rejected")
+	}
+}
+
+func Test_Post_StoreImage_NothingSent(t *testing.T) {
+	// A form without image has nothing to record
+	p := &Post{}
+	verrs, err := p.storeImage(nil, UploadLimits{})
+	if err != nil || !verrs.HasAny() {
+		t.Fatalf("expected the missing image to be refused, got %v %v", verrs, err)
+	}
+	if len(p.Rejections) > 0 {
+		t.Fatalf("expected no rejection, got %v", p.Rejections)
+	}
+}
+
+func Test_FormatBytes(t *testing.T) {
+	for n, expected := range map[int64]string{10 << 20: "10 MB", 512 << 10: "512 KB", 1000: "1000 bytes"} {
+		if s := formatBytes(n); s != expected {
+			t.Fatalf("expected %q, got %q", expected, s)
+		}
+	}
+}
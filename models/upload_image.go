@@ -0,0 +1,167 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"image"
+	_ "image/jpeg" // decodes the uploaded images
+	_ "image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+	"github.com/sampalm/buffalo/blogapp/imaging"
+	"github.com/sampalm/buffalo/blogapp/storage"
+)
+
+// ImageSize is a resized variant made of every uploaded image.
+type ImageSize struct {
+	Name  string
+	Width int
+}
+
+// Image sizes, from the smallest. The thumbnail is shown in the list of
+// posts.
+var (
+	ImageThumb  = ImageSize{Name: "thumb", Width: 320}
+	ImageMedium = ImageSize{Name: "medium", Width: 768}
+	ImageLarge  = ImageSize{Name: "large", Width: 1280}
+)
+
+// ImageSizes lists every variant of an image.
+var ImageSizes = []ImageSize{ImageThumb, ImageMedium, ImageLarge}
+
+// FindImageSize returns the size named name.
+func FindImageSize(name string) (ImageSize, bool) {
+	for _, s := range ImageSizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return ImageSize{}, false
+}
+
+// IsProcessed reports whether the variants of the upload are ready.
+func (u Upload) IsProcessed() bool {
+	return u.ProcessedAt.Valid
+}
+
+// HasVariants reports whether the upload is an image with variants. Files
+// that could not be decoded are processed without any.
+func (u Upload) HasVariants() bool {
+	return u.IsProcessed() && u.Width > 0
+}
+
+// VariantWidth is the width of the variant of size, images are never
+// made larger.
+func (u Upload) VariantWidth(s ImageSize) int {
+	if u.Width < s.Width {
+		return u.Width
+	}
+	return s.Width
+}
+
+// VariantKey names the variant of size in format, "" for the original
+// format.
+func (u Upload) VariantKey(s ImageSize, format string) string {
+	ext := filepath.Ext(u.Key)
+	if format != "" {
+		ext = "." + format
+	}
+	return strings.TrimSuffix(u.Key, filepath.Ext(u.Key)) + "_" + s.Name + ext
+}
+
+// Keys lists the files of the upload in the storage, its variants
+// included.
+func (u Upload) Keys() []string {
+	keys := []string{u.Key}
+	for _, s := range ImageSizes {
+		keys = append(keys, u.VariantKey(s, ""), u.VariantKey(s, imaging.WebP))
+	}
+	return keys
+}
+
+// FindUploads returns the uploads named by keys, by key.
+func FindUploads(tx *pop.Connection, keys ...string) (map[string]Upload, error) {
+	found := map[string]Upload{}
+	if len(keys) == 0 {
+		return found, nil
+	}
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	list := Uploads{}
+	if err := tx.Where("key in (?)", args...).All(&list); err != nil {
+		return found, errors.WithStack(err)
+	}
+	for _, u := range list {
+		found[u.Key] = u
+	}
+	return found, nil
+}
+
+// ProcessUpload makes the variants of an uploaded image: resized to every
+// ImageSizes, in its own format and in WebP.
+// Files that are not images are marked processed without variants.
+func ProcessUpload(tx *pop.Connection, key string, now time.Time) error {
+	u := &Upload{}
+	if err := tx.Where("key = ?", key).First(u); err != nil {
+		// The upload was collected in the meantime
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	if u.IsProcessed() {
+		return nil
+	}
+
+	r, err := storage.Default.Get(u.Key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	content, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The original is stored upright, see StoreUpload
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err == nil {
+		u.Width, u.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		if err := u.storeVariants(img, format); err != nil {
+			return err
+		}
+	}
+	// Only the image fields are written, the references may have changed
+	// while the variants were made
+	err = tx.RawQuery("UPDATE uploads SET width = ?, height = ?, processed_at = ?, updated_at = ? WHERE id = ?",
+		u.Width, u.Height, now, now, u.ID).Exec()
+	return errors.WithStack(err)
+}
+
+// storeVariants resizes img to every ImageSizes and stores the variants.
+func (u *Upload) storeVariants(img image.Image, format string) error {
+	for _, s := range ImageSizes {
+		resized := imaging.Resize(img, s.Width)
+		for _, f := range []string{format, imaging.WebP} {
+			key := u.VariantKey(s, imaging.WebP)
+			if f == format {
+				key = u.VariantKey(s, "")
+			}
+			buf := &bytes.Buffer{}
+			if err := imaging.Encode(buf, resized, f); err != nil {
+				return err
+			}
+			if err := storage.Default.Put(key, buf, "image/"+f); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package models_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sampalm/buffalo/blogapp/imaging"
+	"github.com/sampalm/buffalo/blogapp/models"
+	"github.com/sampalm/buffalo/blogapp/storage"
+)
+
+// tempStorage keeps the uploads of a test in a temporary directory until
+// the returned func is called.
+func (ms *ModelSuite) tempStorage() func() {
+	dir, err := ioutil.TempDir("", "uploads")
+	ms.NoError(err)
+	previous := storage.Default
+	storage.Default = &storage.Local{Dir: dir, BaseURL: "/uploads"}
+	return func() {
+		storage.Default = previous
+		os.RemoveAll(dir)
+	}
+}
+
+func (ms *ModelSuite) Test_Upload_References() {
+	defer ms.tempStorage()()
+
+	// The same content is stored once, whatever the file was called
+	first, err := models.StoreUpload(ms.DB, strings.NewReader("image"), ".PNG")
+	ms.NoError(err)
+	second, err := models.StoreUpload(ms.DB, strings.NewReader("image"), ".png")
+	ms.NoError(err)
+	ms.Equal(first.Key, second.Key)
+	ms.Equal(models.UploadKey([]byte("image"), ".png"), first.Key)
+	n, err := ms.DB.Count(&models.Upload{})
+	ms.NoError(err)
+	ms.Equal(1, n)
+
+	posts := []*models.Post{}
+	for _, title := range []string{"First", "Second"} {
+		p := &models.Post{Title: title, Content: "content", FileName: first.Key, Status: models.PostDraft}
+		verrs, err := p.Create(ms.DB)
+		ms.NoError(err)
+		ms.False(verrs.HasAny())
+		posts = append(posts, p)
+	}
+	u := &models.Upload{}
+	ms.NoError(ms.DB.Where("key = ?", first.Key).First(u))
+	ms.Equal(2, u.RefCount)
+
+	// A file still used by a post is kept
+	ms.NoError(ms.DB.Destroy(posts[0]))
+	ms.NoError(posts[0].DeleteFile(ms.DB))
+	collected, err := models.CollectUploads(ms.DB)
+	ms.NoError(err)
+	ms.Equal(0, collected)
+	ok, err := storage.Default.Exists(first.Key)
+	ms.NoError(err)
+	ms.True(ok)
+
+	// Changing the image of the last post releases the file
+	posts[1].FileName = ""
+	verrs, err := posts[1].Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	collected, err = models.CollectUploads(ms.DB)
+	ms.NoError(err)
+	ms.Equal(1, collected)
+	ok, err = storage.Default.Exists(first.Key)
+	ms.NoError(err)
+	ms.False(ok)
+
+	// Posts can't point to files that are not stored
+	posts[1].FileName = first.Key
+	verrs, err = posts[1].Update(ms.DB)
+	ms.NoError(err)
+	ms.True(verrs.HasAny())
+}
+
+func (ms *ModelSuite) Test_Upload_Process() {
+	defer ms.tempStorage()()
+
+	content := &bytes.Buffer{}
+	ms.NoError(png.Encode(content, image.NewRGBA(image.Rect(0, 0, 1000, 500))))
+	u, err := models.StoreUpload(ms.DB, content, ".png")
+	ms.NoError(err)
+	ms.False(u.IsProcessed())
+
+	ms.NoError(models.ProcessUpload(ms.DB, u.Key, time.Now()))
+	ms.NoError(ms.DB.Reload(u))
+	ms.True(u.HasVariants())
+	ms.Equal(1000, u.Width)
+	ms.Equal(500, u.Height)
+
+	r, err := storage.Default.Get(u.VariantKey(models.ImageThumb, ""))
+	ms.NoError(err)
+	thumb, err := png.Decode(r)
+	r.Close()
+	ms.NoError(err)
+	ms.Equal(320, thumb.Bounds().Dx())
+	ms.Equal(160, thumb.Bounds().Dy())
+	ok, err := storage.Default.Exists(u.VariantKey(models.ImageLarge, imaging.WebP))
+	ms.NoError(err)
+	ms.True(ok)
+
+	// Files that are no images are processed without variants
+	u, err = models.StoreUpload(ms.DB, strings.NewReader("not an image"), ".jpg")
+	ms.NoError(err)
+	ms.NoError(models.ProcessUpload(ms.DB, u.Key, time.Now()))
+	ms.NoError(ms.DB.Reload(u))
+	ms.True(u.IsProcessed())
+	ms.False(u.HasVariants())
+}
+
+func (ms *ModelSuite) Test_Upload_Sweep() {
+	defer ms.tempStorage()()
+
+	u, err := models.StoreUpload(ms.DB, strings.NewReader("kept"), ".png")
+	ms.NoError(err)
+	// The file of a rolled back upload has no row
+	ms.NoError(storage.Default.Put("orphan.png", strings.NewReader("orphan"), "image/png"))
+
+	// Recent files may still be committed
+	swept, err := models.SweepUploads(ms.DB, time.Now().Add(-time.Hour))
+	ms.NoError(err)
+	ms.Equal(0, swept)
+
+	swept, err = models.SweepUploads(ms.DB, time.Now().Add(time.Minute))
+	ms.NoError(err)
+	ms.Equal(1, swept)
+	ok, err := storage.Default.Exists("orphan.png")
+	ms.NoError(err)
+	ms.False(ok)
+	ok, err = storage.Default.Exists(u.Key)
+	ms.NoError(err)
+	ms.True(ok)
+}
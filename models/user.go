@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
@@ -15,18 +17,23 @@ import (
 )
 
 type User struct {
-	ID              uuid.UUID `json:"id" db:"id"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
-	Name            string    `json:"name" db:"name"`
-	Username        string    `json:"username" db:"username"`
-	Email           string    `json:"email" db:"email"`
-	Admin           bool      `json:"admin" db:"admin"`
-	PasswordHash    string    `json:"-" db:"password_hash"`
-	Password        string    `json:"-" db:"-"`
-	PasswordConfirm string    `json:"-" db:"-"`
-	Provider        string    `json:"provider" db:"provider"`
-	ProviderID      string    `json:"provider_id" db:"provider_id"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	Name            string     `json:"name" db:"name"`
+	Username        string     `json:"username" db:"username"`
+	Email           string     `json:"email" db:"email"`
+	EmailVerifiedAt nulls.Time `json:"email_verified_at" db:"email_verified_at" form:"-"`
+	Role            string     `json:"role" db:"role" form:"-"`
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	Password        string     `json:"-" db:"-"`
+	PasswordConfirm string     `json:"-" db:"-"`
+	TOTPSecret      string     `json:"-" db:"totp_secret" form:"-"`
+	TOTPEnabledAt   nulls.Time `json:"-" db:"totp_enabled_at" form:"-"`
+	TOTPLastStep    int64      `json:"-" db:"totp_last_step" form:"-"`
+	NotifyComments  string     `json:"-" db:"notify_comments" form:"-"`
+	NotifyReplies   string     `json:"-" db:"notify_replies" form:"-"`
+	DigestSentAt    nulls.Time `json:"-" db:"digest_sent_at" form:"-"`
 }
 
 type ItsAvailable struct {
@@ -36,39 +43,47 @@ type ItsAvailable struct {
 	tx     *pop.Connection
 }
 
-// Create a new user into database
-func (u User) Create(tx *pop.Connection) (*validate.Errors, error) {
+// Create a new user into database. The email of the user starts
+// unverified.
+func (u *User) Create(tx *pop.Connection) (*validate.Errors, error) {
 	// Default user account
-	u.Admin = false
+	u.Role = RoleCommenter
 	// Validade user password
 	pwdHash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return validate.NewErrors(), errors.WithStack(err)
 	}
 	u.PasswordHash = string(pwdHash)
-	return tx.ValidateAndCreate(&u)
+	u.EmailVerifiedAt = nulls.Time{}
+	return tx.ValidateAndCreate(u)
 }
 
-func (u User) Update(tx *pop.Connection) (*validate.Errors, error) {
+// Update saves the changes of the user. Changing the email requires the
+// new address to be verified again. The role is kept, it only changes
+// through SetRole, and so is the verification, which only VerifyEmail
+// sets.
+func (u *User) Update(tx *pop.Connection) (*validate.Errors, error) {
+	stored := &User{}
+	if err := tx.Find(stored, u.ID); err != nil {
+		return validate.NewErrors(), errors.WithStack(err)
+	}
+	u.Role = stored.Role
+	u.EmailVerifiedAt = stored.EmailVerifiedAt
+
 	// Validate user password
 	if u.Password != "" {
-		if check := validate.Validate(
-			&validators.StringLengthInRange{Field: u.Password, Name: "Password", Min: 6, Max: 20, Message: "Password is too weak."},
-			&validators.StringsMatch{Field: u.Password, Field2: u.PasswordConfirm, Name: "PasswordConfirm", Message: "Passwords do not match"},
-		); check != nil {
+		if check := ValidatePassword(u.Password, u.PasswordConfirm); check.HasAny() {
 			return check, nil
 		}
-		pwdHash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return validate.NewErrors(), errors.WithStack(err)
+		if err := u.SetPassword(u.Password); err != nil {
+			return validate.NewErrors(), err
 		}
-		u.PasswordHash = string(pwdHash)
 	}
 	// Validate user email
 	if u.Email != "" {
 		if check := validate.Validate(
 			&validators.EmailLike{Field: u.Email, Name: "Email"},
-		); check != nil {
+		); check.HasAny() {
 			return check, nil
 		}
 		exists, err := tx.Where("email = ? AND id != ?", u.Email, u.ID).Exists(u)
@@ -80,9 +95,49 @@ func (u User) Update(tx *pop.Connection) (*validate.Errors, error) {
 			verrs.Add("Email", "Email is already being used.")
 			return verrs, nil
 		}
+		if !strings.EqualFold(stored.Email, u.Email) {
+			u.EmailVerifiedAt = nulls.Time{}
+		}
+	}
+
+	return validate.NewErrors(), tx.Update(u)
+}
+
+// ValidatePassword checks the strength of a new password and that it was
+// confirmed.
+func ValidatePassword(password, confirm string) *validate.Errors {
+	return validate.Validate(
+		&validators.StringLengthInRange{Field: password, Name: "Password", Min: 6, Max: 20, Message: "Password is too weak."},
+		&validators.StringsMatch{Field: password, Field2: confirm, Name: "PasswordConfirm", Message: "Passwords do not match"},
+	)
+}
+
+// SetPassword replaces the password hash of the user.
+func (u *User) SetPassword(password string) error {
+	pwdHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.WithStack(err)
 	}
+	u.PasswordHash = string(pwdHash)
+	return nil
+}
+
+// HasPassword reports whether the user can log in with a password.
+// Accounts registered through a provider have none.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
 
-	return validate.NewErrors(), tx.Update(&u)
+// SetRole changes the role of the user.
+func (u *User) SetRole(tx *pop.Connection, role string) (*validate.Errors, error) {
+	verrs := validate.Validate(
+		&validators.StringInclusion{Field: role, Name: "Role", List: Roles},
+	)
+	if verrs.HasAny() {
+		return verrs, nil
+	}
+	u.Role = role
+	return verrs, errors.WithStack(tx.Update(u))
 }
 
 func (u *User) Authorize(tx *pop.Connection) error {
@@ -102,13 +157,21 @@ func (u *User) Authorize(tx *pop.Connection) error {
 	return nil
 }
 
+// OAuthAndSave saves a user registered through an OAuth provider. Some
+// providers have no nickname, the username then comes from the email.
 func (u *User) OAuthAndSave(tx *pop.Connection) error {
+	if u.Role == "" {
+		u.Role = RoleCommenter
+	}
+	if u.Username == "" {
+		u.Username = strings.Split(u.Email, "@")[0]
+	}
 	exists, err := tx.Where("username = ?", u.Username).Exists(u)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	if exists {
-		u.Username = fmt.Sprintf("%s%d", u.Username, u.CreatedAt.UnixNano())
+	if exists || u.Username == "" {
+		u.Username = fmt.Sprintf("%s%d", u.Username, time.Now().UnixNano())
 	}
 	return tx.Save(u)
 }
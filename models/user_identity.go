@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/pkg/errors"
+)
+
+// UserIdentity links a user to an account of an OAuth provider. A user
+// can log in with each of their identities.
+type UserIdentity struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	Provider   string    `json:"provider" db:"provider"`
+	ProviderID string    `json:"provider_id" db:"provider_id"`
+	Email      string    `json:"email" db:"email"`
+}
+
+type UserIdentities []UserIdentity
+
+// FindUserByIdentity finds the user linked to the provider account.
+func FindUserByIdentity(tx *pop.Connection, provider, providerID string) (*User, error) {
+	i := &UserIdentity{}
+	if err := tx.Where("provider = ? AND provider_id = ?", provider, providerID).First(i); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	u := &User{}
+	if err := tx.Find(u, i.UserID); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// FindUserByEmail finds the user using email, ignoring the case.
+func FindUserByEmail(tx *pop.Connection, email string) (*User, error) {
+	u := &User{}
+	if err := tx.Where("lower(email) = ?", strings.ToLower(email)).First(u); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return u, nil
+}
+
+// Identities returns the provider accounts linked to the user.
+func (u *User) Identities(tx *pop.Connection) (UserIdentities, error) {
+	ids := UserIdentities{}
+	err := tx.Where("user_id = ?", u.ID).Order("provider").All(&ids)
+	return ids, errors.WithStack(err)
+}
+
+// LinkIdentity links the provider account to the user.
+func (u *User) LinkIdentity(tx *pop.Connection, provider, providerID, email string) error {
+	i := &UserIdentity{UserID: u.ID, Provider: provider, ProviderID: providerID, Email: email}
+	return errors.WithStack(tx.Create(i))
+}
+
+// UnlinkIdentity removes a provider account of the user. The last way to
+// log in of an account without password can't be removed.
+func (u *User) UnlinkIdentity(tx *pop.Connection, id string) (bool, error) {
+	ids, err := u.Identities(tx)
+	if err != nil {
+		return false, err
+	}
+	for _, i := range ids {
+		if i.ID.String() != id {
+			continue
+		}
+		if !u.HasPassword() && len(ids) == 1 {
+			return false, nil
+		}
+		return true, errors.WithStack(tx.Destroy(&i))
+	}
+	return false, nil
+}
@@ -0,0 +1,31 @@
+package models_test
+
+import "github.com/sampalm/buffalo/blogapp/models"
+
+func (ms *ModelSuite) Test_User_Identities() {
+	user := &models.User{Name: "Linked", Email: "Linked@example.com"}
+	ms.NoError(user.OAuthAndSave(ms.DB))
+	ms.Equal("Linked", user.Username)
+	ms.NoError(user.LinkIdentity(ms.DB, "github", "42", user.Email))
+	ms.NoError(user.LinkIdentity(ms.DB, "gitlab", "7", user.Email))
+	ms.Error(user.LinkIdentity(ms.DB, "github", "42", user.Email))
+
+	found, err := models.FindUserByIdentity(ms.DB, "gitlab", "7")
+	ms.NoError(err)
+	ms.Equal(user.ID, found.ID)
+	found, err = models.FindUserByEmail(ms.DB, "linked@EXAMPLE.com")
+	ms.NoError(err)
+	ms.Equal(user.ID, found.ID)
+
+	ids, err := user.Identities(ms.DB)
+	ms.NoError(err)
+	ms.Len(ids, 2)
+
+	// Users without password keep their last identity
+	ok, err := user.UnlinkIdentity(ms.DB, ids[0].ID.String())
+	ms.NoError(err)
+	ms.True(ok)
+	ok, err = user.UnlinkIdentity(ms.DB, ids[1].ID.String())
+	ms.NoError(err)
+	ms.False(ok)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/pkg/errors"
+)
+
+// verifyPurpose is the purpose of the signed email verification tokens.
+const verifyPurpose = "verify-email"
+
+// EmailVerificationTTL is how long an email verification link can be used.
+const EmailVerificationTTL = 72 * time.Hour
+
+// IsVerified reports whether the user proved to own their email address.
+func (u *User) IsVerified() bool {
+	return u != nil && u.EmailVerifiedAt.Valid
+}
+
+// VerificationToken returns a signed token verifying the current email of
+// the user. It stops working once the email changes.
+func (u *User) VerificationToken(now time.Time) string {
+	return SignToken(verifyPurpose, u.ID.String()+":"+u.Email, now.Add(EmailVerificationTTL))
+}
+
+// FindUserByVerificationToken finds the user whose current email is
+// verified by token.
+func FindUserByVerificationToken(tx *pop.Connection, token string, now time.Time) (*User, error) {
+	subject, err := VerifySignedToken(verifyPurpose, token, now)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(subject, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed verification token")
+	}
+	u := &User{}
+	if err := tx.Find(u, parts[0]); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if u.Email != parts[1] {
+		return nil, errors.New("the email changed since the token was sent")
+	}
+	return u, nil
+}
+
+// VerifyEmail marks the email of the user as verified.
+func (u *User) VerifyEmail(tx *pop.Connection, now time.Time) error {
+	u.EmailVerifiedAt = nulls.NewTime(now)
+	err := tx.RawQuery("UPDATE users SET email_verified_at = ? WHERE id = ?", now, u.ID).Exec()
+	return errors.WithStack(err)
+}
@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/sampalm/buffalo/blogapp/models"
+)
+
+func (ms *ModelSuite) Test_User_VerificationToken() {
+	user := &models.User{Name: "Verify", Username: "verify", Email: "verify@example.com", Password: "secret", PasswordConfirm: "secret"}
+	verrs, err := user.Create(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.False(user.IsVerified())
+
+	now := time.Now()
+	token := user.VerificationToken(now)
+
+	// The verification can't be set by an update
+	user.EmailVerifiedAt = nulls.NewTime(now)
+	user.Name = "Verified"
+	verrs, err = user.Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.NoError(ms.DB.Reload(user))
+	ms.False(user.IsVerified())
+
+	found, err := models.FindUserByVerificationToken(ms.DB, token, now)
+	ms.NoError(err)
+	ms.Equal(user.ID, found.ID)
+	ms.NoError(found.VerifyEmail(ms.DB, now))
+	ms.True(found.IsVerified())
+
+	// Changing the email asks for a new verification
+	found.Email = "changed@example.com"
+	verrs, err = found.Update(ms.DB)
+	ms.NoError(err)
+	ms.False(verrs.HasAny())
+	ms.False(found.IsVerified())
+
+	_, err = models.FindUserByVerificationToken(ms.DB, token, now)
+	ms.Error(err)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Local keeps the files in Dir, served by the application under BaseURL.
+// Its URLs are not signed: the files are public.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// path returns the file of key, which can't escape Dir.
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", errors.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the file, creating its directory.
+func (l *Local) Put(key string, r io.Reader, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	// Write aside then rename, readers never see half a file. Each write
+	// gets its own file, concurrent ones don't mix.
+	tmp, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.WithStack(err)
+	}
+	// TempFile makes it private, uploads are served to everyone
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), p))
+}
+
+// Get opens the file.
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, errors.WithStack(err)
+}
+
+// Delete removes the file.
+func (l *Local) Delete(key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Exists looks for the file.
+func (l *Local) Exists(key string) (bool, error) {
+	_, err := l.Size(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Size returns the size of the file.
+func (l *Local) Size(key string) (int64, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return info.Size(), nil
+}
+
+// List walks Dir for the files last written before t.
+func (l *Local) List(before time.Time) ([]string, error) {
+	keys := []string{}
+	err := filepath.Walk(l.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Nothing was stored yet
+			if p == l.Dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !info.ModTime().Before(before) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Dir, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	return keys, errors.WithStack(err)
+}
+
+// URL returns the public url of the file.
+func (l *Local) URL(key string, expires time.Duration) (string, error) {
+	return strings.TrimRight(l.BaseURL, "/") + "/" + strings.TrimLeft(key, "/"), nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Local(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := &Local{Dir: dir, BaseURL: "/uploads/"}
+	testStorage(t, l)
+
+	if u, _ := l.URL("a/b.png", 0); u != "/uploads/a/b.png" {
+		t.Fatalf("unexpected url %q", u)
+	}
+	// Keys stay inside the directory
+	if err := l.Put("../../escaped", strings.NewReader("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dir + "/escaped")
+	if err != nil {
+		t.Fatalf("expected the file inside the directory: %v", err)
+	}
+	// Files are readable by the web server, not only by their owner
+	if info.Mode().Perm() != 0644 {
+		t.Fatalf("expected the file mode 0644, got %v", info.Mode().Perm())
+	}
+	// Nothing is left of the temporary files
+	if keys, err := l.List(time.Now().Add(time.Hour)); err != nil || len(keys) != 1 || keys[0] != "escaped" {
+		t.Fatalf("expected only the escaped file, got %v %v", keys, err)
+	}
+}
+
+// testStorage puts, reads and deletes a file of s.
+func testStorage(t *testing.T, s Storage) {
+	if ok, err := s.Exists("image.png"); err != nil || ok {
+		t.Fatalf("expected no file, got %v %v", ok, err)
+	}
+	if _, err := s.Get("image.png"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := s.Put("image.png", strings.NewReader("content"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Exists("image.png"); err != nil || !ok {
+		t.Fatalf("expected the file, got %v %v", ok, err)
+	}
+	if keys, err := s.List(time.Now().Add(time.Hour)); err != nil || len(keys) != 1 || keys[0] != "image.png" {
+		t.Fatalf("expected the file listed, got %v %v", keys, err)
+	}
+	if keys, err := s.List(time.Now().Add(-time.Hour)); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no file stored an hour ago, got %v %v", keys, err)
+	}
+	if size, err := s.Size("image.png"); err != nil || size != 7 {
+		t.Fatalf("expected 7 bytes, got %d %v", size, err)
+	}
+	r, err := s.Get("image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "content" {
+		t.Fatalf("unexpected content %q %v", b, err)
+	}
+
+	if err := s.Delete("image.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("image.png"); err != nil {
+		t.Fatalf("deleting a missing file: %v", err)
+	}
+	if ok, _ := s.Exists("image.png"); ok {
+		t.Fatal("expected the file to be deleted")
+	}
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3 keeps the files in a bucket of an S3 compatible object store, like
+// AWS S3 or MinIO. Buckets are addressed by path, and the files are
+// private: their URLs are presigned, unless PublicURL is set.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is the root of unsigned links to the files, when the
+	// bucket is public or behind a CDN.
+	PublicURL string
+	Client    *http.Client
+	// now returns the current time, time.Now when nil.
+	now func() time.Time
+}
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Put uploads the file.
+func (s *S3) Put(key string, r io.Reader, contentType string) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	res, err := s.do("PUT", key, nil, header, body)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Get downloads the file.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	res, err := s.do("GET", key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Delete removes the file.
+func (s *S3) Delete(key string) error {
+	res, err := s.do("DELETE", key, nil, nil, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Exists asks for the headers of the file.
+func (s *S3) Exists(key string) (bool, error) {
+	_, err := s.Size(key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Size asks for the headers of the file.
+func (s *S3) Size(key string) (int64, error) {
+	res, err := s.do("HEAD", key, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.ContentLength, nil
+}
+
+// listPage is a page of the ListObjectsV2 answer.
+type listPage struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through the objects of the bucket.
+func (s *S3) List(before time.Time) ([]string, error) {
+	keys := []string{}
+	query := url.Values{"list-type": {"2"}}
+	for {
+		res, err := s.do("GET", "", query, nil, nil)
+		if err != nil {
+			return keys, err
+		}
+		page := listPage{}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return keys, errors.WithStack(err)
+		}
+		for _, o := range page.Contents {
+			if o.LastModified.Before(before) {
+				keys = append(keys, o.Key)
+			}
+		}
+		if !page.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// URL presigns a link to the file valid for expires, at most 7 days.
+func (s *S3) URL(key string, expires time.Duration) (string, error) {
+	if s.PublicURL != "" {
+		return strings.TrimRight(s.PublicURL, "/") + "/" + uriEncode(key, false), nil
+	}
+	if expires > 7*24*time.Hour {
+		expires = 7 * 24 * time.Hour
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	now := s.clock().UTC()
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u.RawQuery = canonicalQuery(q)
+	header := http.Header{"Host": {u.Host}}
+	signature := s.signature("GET", u, header, []string{"host"}, unsignedPayload, now)
+	return u.String() + "&X-Amz-Signature=" + signature, nil
+}
+
+func (s *S3) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// objectURL returns the path style url of the file, escaped the way it
+// is signed.
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket + "/" + strings.TrimLeft(key, "/")
+	u.RawPath = uriEncode(u.Path, false)
+	return u, nil
+}
+
+// do sends a signed request for the file, or the bucket when key is
+// empty. Missing files are ErrNotFound, other failures are returned with
+// the answer of the store.
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	now := s.clock().UTC()
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	signing := http.Header{
+		"Host":                 {u.Host},
+		"X-Amz-Content-Sha256": {payload},
+		"X-Amz-Date":           {now.Format(amzDateFormat)},
+	}
+	signature := s.signature(method, u, signing, signed, payload, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, s.scope(now), strings.Join(signed, ";"), signature))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, errors.Errorf("storage: %s %s: %s %s", method, key, res.Status, msg)
+	}
+	return res, nil
+}
+
+// scope is the credential scope of requests signed at t.
+func (s *S3) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+// signature signs a request with AWS Signature Version 4.
+func (s *S3) signature(method string, u *url.URL, header http.Header, signed []string, payload string, t time.Time) string {
+	headers := &bytes.Buffer{}
+	for _, h := range signed {
+		fmt.Fprintf(headers, "%s:%s\n", h, strings.TrimSpace(header.Get(h)))
+	}
+	canonical := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		u.RawQuery,
+		headers.String(),
+		strings.Join(signed, ";"),
+		payload,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateFormat),
+		s.scope(t),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	key := signingKey(s.SecretKey, t.Format("20060102"), s.Region, "s3")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+// signingKey derives the key signing the requests of a day.
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key, as signed.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, and the
+// slashes unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
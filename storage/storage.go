@@ -0,0 +1,70 @@
+// Package storage keeps the uploaded files, on the local disk or in an S3
+// compatible object store, so every app container sees the same files.
+package storage
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned for keys without a file.
+var ErrNotFound = errors.New("storage: file not found")
+
+// Storage stores files by key.
+type Storage interface {
+	// Put saves the content of r under key.
+	Put(key string, r io.Reader, contentType string) error
+	// Get opens the file of key.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the file of key. Missing files are not an error.
+	Delete(key string) error
+	// Exists reports whether there is a file under key.
+	Exists(key string) (bool, error)
+	// Size returns the size of the file of key in bytes.
+	Size(key string) (int64, error)
+	// URL returns a link to the file of key that works for at least
+	// expires, signed when the files are private.
+	URL(key string, expires time.Duration) (string, error)
+	// List returns the keys of the files stored before t.
+	List(before time.Time) ([]string, error)
+}
+
+// Default is where the application keeps its uploads. It is chosen from
+// the STORAGE environment variable: "local" or "s3".
+var Default Storage
+
+func init() {
+	var err error
+	Default, err = New(envy.Get("STORAGE", "local"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// New builds the storage named name from the environment. Local files
+// go to UPLOADS_DIR, S3 needs S3_ENDPOINT, S3_REGION, S3_BUCKET,
+// S3_ACCESS_KEY and S3_SECRET_KEY.
+func New(name string) (Storage, error) {
+	switch name {
+	case "local":
+		return &Local{
+			Dir:     envy.Get("UPLOADS_DIR", filepath.Join("public", "uploads")),
+			BaseURL: envy.Get("UPLOADS_URL", "/uploads"),
+		}, nil
+	case "s3":
+		return &S3{
+			Endpoint:  envy.Get("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:    envy.Get("S3_REGION", "us-east-1"),
+			Bucket:    envy.Get("S3_BUCKET", ""),
+			AccessKey: envy.Get("S3_ACCESS_KEY", ""),
+			SecretKey: envy.Get("S3_SECRET_KEY", ""),
+			PublicURL: envy.Get("S3_PUBLIC_URL", ""),
+		}, nil
+	}
+	return nil, errors.Errorf("storage: unknown storage %q", name)
+}